@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/fr12k/go-mask/pkg/markdown"
+)
+
+// ErrDocTestFailed is returned by DocTest if at least one block failed.
+var ErrDocTestFailed = errors.New("doctest failed")
+
+type (
+	// DocTestResult holds the outcome of every go block that was checked.
+	DocTestResult struct {
+		Blocks []BlockResult
+	}
+
+	BlockResult struct {
+		File    string
+		Line    int
+		Heading string
+		Skipped bool
+		Err     error
+		// Output explains the failure, e.g. the compiler errors or the
+		// difference to the expected output.
+		Output string
+	}
+)
+
+// Failed returns the number of failed blocks.
+func (r DocTestResult) Failed() int {
+	failed := 0
+	for _, b := range r.Blocks {
+		if b.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// DocTest checks every go block of the Markdown files given as arguments
+// after the flags. Each block is generated with the config defaults plus its
+// own attributes and written to a directory of its own. Blocks are run if
+// the command is run or they are followed by an ```output block their
+// output has to match, otherwise they are only compiled. A block with the
+// skip attribute is ignored.
+func (g *GoMask) DocTest(ctx context.Context) (DocTestResult, error) {
+	cfg, err := g.loadConfig()
+	if err != nil {
+		return DocTestResult{}, err
+	}
+	if flag.NArg() == 0 {
+		return DocTestResult{}, errors.New("doctest needs at least one Markdown file")
+	}
+	cfg.Script, cfg.ProgramArgs = "", nil
+
+	var result DocTestResult
+	for _, path := range flag.Args() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return result, err
+		}
+		for _, block := range markdown.Parse(string(content)) {
+			if !block.IsGo() {
+				continue
+			}
+			res := BlockResult{File: path, Line: block.Start, Heading: block.Heading}
+			if slices.Contains(block.Attrs, "skip") {
+				res.Skipped = true
+			} else {
+				res.Output, res.Err = g.docTestBlock(ctx, cfg, path, block)
+			}
+			result.Blocks = append(result.Blocks, res)
+			g.report(res)
+		}
+	}
+
+	failed := result.Failed()
+	fmt.Fprintf(g.out(), "%d blocks, %d failed\n", len(result.Blocks), failed)
+	if failed > 0 {
+		return result, ErrDocTestFailed
+	}
+	return result, nil
+}
+
+func (g *GoMask) docTestBlock(ctx context.Context, base *config.Config, path string, block markdown.Block) (string, error) {
+	// The code of an empty block would be read from stdin instead.
+	if strings.TrimSpace(block.Code) == "" {
+		return "", fmt.Errorf("go block at line %d is empty", block.Start)
+	}
+	cfg := *base
+	cfg.Imports = slices.Clone(base.Imports)
+	cfg.Require = slices.Clone(base.Require)
+	cfg.Replace = slices.Clone(base.Replace)
+	cfg.Code = block.Code
+	cfg.Source = path
+	cfg.Line = block.Line()
+	if err := config.ApplyAttributes(&cfg, block.Attrs); err != nil {
+		return "", err
+	}
+	if err := config.ApplyFlags(&cfg); err != nil {
+		return "", err
+	}
+	// The arguments after the flags are the Markdown files.
+	cfg.Script, cfg.ProgramArgs = "", base.ProgramArgs
+
+	dir, err := os.MkdirTemp("", "go-mask-doctest-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	cfg.Directory = dir
+	if block.Output != nil {
+		cfg.Command = "run"
+	}
+	if cfg.Command == "build" {
+		cfg.Output = filepath.Join(dir, "go-mask")
+	}
+
+	// The output is checked instead of shown, so it is only captured, and
+	// the errors are part of the report.
+	command := *g.command
+	command.Stdin, command.Stdout, command.Stderr = nil, nil, nil
+	command.Quiet = true
+	doc := *g
+	doc.command, doc.stdout = &command, nil
+
+	res, err := doc.execute(ctx, &cfg)
+	if err != nil {
+		return res.Stdout + res.Stderr, fmt.Errorf("%s: %w", res.Stage, err)
+	}
+	if block.Output != nil && strings.TrimRight(res.Stdout, "\n") != strings.TrimRight(block.Output.Code, "\n") {
+		return fmt.Sprintf("want:\n%sgot:\n%s", block.Output.Code, res.Stdout), errors.New("output mismatch")
+	}
+	return "", nil
+}
+
+func (g *GoMask) report(res BlockResult) {
+	out := g.out()
+	switch {
+	case res.Skipped:
+		fmt.Fprintf(out, "skip  %s:%d %s\n", res.File, res.Line, res.Heading)
+	case res.Err == nil:
+		fmt.Fprintf(out, "ok    %s:%d %s\n", res.File, res.Line, res.Heading)
+	default:
+		fmt.Fprintf(out, "FAIL  %s:%d %s: %v\n", res.File, res.Line, res.Heading, res.Err)
+		for line := range strings.Lines(res.Output) {
+			fmt.Fprintf(out, "      %s", line)
+		}
+		if res.Output != "" && !strings.HasSuffix(res.Output, "\n") {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+func (g *GoMask) out() io.Writer {
+	if g.stdout != nil {
+		return g.stdout
+	}
+	return io.Discard
+}
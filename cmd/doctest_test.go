@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const docTestMarkdown = "# Doc\n" +
+	"\n" +
+	"## hello\n" +
+	"\n" +
+	"```go\n" +
+	"fmt.Println(\"Hello\")\n" +
+	"```\n" +
+	"\n" +
+	"```output\n" +
+	"Hello\n" +
+	"```\n" +
+	"\n" +
+	"## mismatch\n" +
+	"\n" +
+	"```go\n" +
+	"fmt.Println(\"Bye\")\n" +
+	"```\n" +
+	"\n" +
+	"```output\n" +
+	"Hello\n" +
+	"```\n" +
+	"\n" +
+	"## broken\n" +
+	"\n" +
+	"```go\n" +
+	"undefinedThing()\n" +
+	"```\n" +
+	"\n" +
+	"## fragment\n" +
+	"\n" +
+	"```go skip\n" +
+	"cfg := config.New()\n" +
+	"```\n" +
+	"\n" +
+	"## compile only\n" +
+	"\n" +
+	"```go\n" +
+	"for {\n" +
+	"}\n" +
+	"```\n" +
+	"\n" +
+	"## empty\n" +
+	"\n" +
+	"```go\n" +
+	"```\n"
+
+func TestDocTest(t *testing.T) {
+	md := filepath.Join(t.TempDir(), "Doc.md")
+	require.NoError(t, os.WriteFile(md, []byte(docTestMarkdown), 0o600))
+
+	os.Args = []string{"go-mask", md}
+	var stdout bytes.Buffer
+	gomask := NewGoMask(
+		WithConfig(&config.Config{Command: "build", MainFunc: true, Package: "main"}),
+		WithOutput(&stdout, &bytes.Buffer{}),
+	)
+	// The report on stdout is the only output, stderr stays empty.
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = w
+	res, err := gomask.DocTest(context.Background())
+	os.Stderr = stderr
+	w.Close()
+	require.ErrorIs(t, err, ErrDocTestFailed)
+	messages, rerr := io.ReadAll(r)
+	require.NoError(t, rerr)
+	assert.Empty(t, string(messages))
+
+	require.Len(t, res.Blocks, 6)
+	assert.Equal(t, 3, res.Failed())
+	assert.NoError(t, res.Blocks[0].Err)
+	assert.EqualError(t, res.Blocks[1].Err, "output mismatch")
+	assert.Equal(t, "want:\nHello\ngot:\nBye\n", res.Blocks[1].Output)
+	assert.ErrorContains(t, res.Blocks[2].Err, "compile: ")
+	assert.Contains(t, res.Blocks[2].Output, "Doc.md:26:1: undefined: undefinedThing")
+	assert.True(t, res.Blocks[3].Skipped)
+	assert.NoError(t, res.Blocks[4].Err, "the build command only compiles")
+	assert.EqualError(t, res.Blocks[5].Err, "go block at line 44 is empty", "the code isn't read from stdin")
+
+	assert.Contains(t, stdout.String(), "ok    "+md+":5 hello\n")
+	assert.Contains(t, stdout.String(), "FAIL  "+md+":15 mismatch: output mismatch\n")
+	assert.Contains(t, stdout.String(), "skip  "+md+":31 fragment\n")
+	assert.Contains(t, stdout.String(), "FAIL  "+md+":44 empty: go block at line 44 is empty\n")
+	assert.Contains(t, stdout.String(), "6 blocks, 3 failed\n")
+}
+
+func TestDocTestNoFiles(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	_, err := NewGoMask(WithConfig(&config.Config{})).DocTest(context.Background())
+	assert.EqualError(t, err, "doctest needs at least one Markdown file")
+}
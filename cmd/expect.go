@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/fr12k/go-mask/pkg/expect"
+	"github.com/fr12k/go-mask/pkg/markdown"
+)
+
+// expect checks the outcome of the program against the expectations of the
+// config, or rewrites them in their source with -update.
+func (g *GoMask) expect(cfg *config.Config, res Result) error {
+	out := expect.Outcome{Stdout: res.Stdout, Stderr: res.Stderr, ExitCode: res.ExitCode}
+	if cfg.Update {
+		path, err := g.updateExpectations(cfg, out)
+		if err != nil {
+			fmt.Fprintf(g.messages(), "Error updating expectations: %v\n", err)
+			return err
+		}
+		fmt.Fprintf(g.messages(), "Updated expectations in %s\n", path)
+		return nil
+	}
+
+	mismatches, err := expect.Check(cfg, out)
+	if err != nil {
+		fmt.Fprintf(g.messages(), "Error checking expectations: %v\n", err)
+		return err
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	for _, m := range mismatches {
+		fmt.Fprint(g.messages(), m.Report)
+	}
+	return expect.Error(mismatches)
+}
+
+// updateExpectations writes the outcome to the output block of the Markdown
+// block or to the config file and returns the path of the file.
+func (g *GoMask) updateExpectations(cfg *config.Config, out expect.Outcome) (string, error) {
+	if cfg.Markdown != "" {
+		return cfg.Markdown, updateMarkdown(cfg, out)
+	}
+
+	path := g.loader.File.FilePath
+	if exists, err := g.loader.File.Exists(); path == "" || err != nil || !exists {
+		return "", errors.New("no config file to update")
+	}
+	values := map[string]any{"expect_stdout": out.Stdout}
+	if cfg.ExpectStderr != nil || out.Stderr != "" {
+		values["expect_stderr"] = out.Stderr
+	}
+	if cfg.ExpectExitCode != nil || out.ExitCode != 0 {
+		values["expect_exit_code"] = out.ExitCode
+	}
+	return path, config.UpdateFile(path, values)
+}
+
+// updateMarkdown replaces the output block of the selected block with the
+// stdout of the program and sets its expect-exit-code attribute if the exit
+// code isn't zero.
+func updateMarkdown(cfg *config.Config, out expect.Outcome) error {
+	info, err := os.Stat(cfg.Markdown)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(cfg.Markdown)
+	if err != nil {
+		return err
+	}
+	block, err := markdown.Select(markdown.Parse(string(content)), cfg.Heading, cfg.Block)
+	if err != nil {
+		return err
+	}
+
+	attrs := slices.DeleteFunc(slices.Clone(block.Attrs), func(attr string) bool {
+		return strings.HasPrefix(attr, "expect-exit-code=")
+	})
+	if out.ExitCode != 0 {
+		attrs = append(attrs, "expect-exit-code="+strconv.Itoa(out.ExitCode))
+	}
+	updated := markdown.Rewrite(string(content), block, attrs, out.Stdout)
+	return os.WriteFile(cfg.Markdown, []byte(updated), info.Mode().Perm())
+}
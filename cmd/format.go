@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/cmd"
+	"github.com/fr12k/go-mask/pkg/code"
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/fr12k/go-mask/pkg/markdown"
+	"github.com/fr12k/go-mask/pkg/txtar"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// format formats the snippet like gofmt and prints it or, with -w, writes
+// it back to where it came from.
+func (g *GoMask) format(cfg *config.Config, src string) (Result, error) {
+	formatted, err := formatSource(cfg, src)
+	if err != nil {
+		fmt.Fprintf(g.messages(), "Error formatting code: %v\n", err)
+		return Result{Stage: cmd.StageGenerate}, err
+	}
+	if !cfg.Write {
+		g.print(formatted)
+		return Result{Stdout: formatted, Stage: cmd.StageGenerate}, nil
+	}
+	if err := writeBack(cfg, formatted); err != nil {
+		fmt.Fprintf(g.messages(), "Error writing code: %v\n", err)
+		return Result{Stage: cmd.StageWrite}, err
+	}
+	return Result{Stage: cmd.StageWrite}, nil
+}
+
+// fix maps the files go fix rewrote back to the source of the snippet and
+// prints the changes as a diff or, with -w, writes them back.
+func (g *GoMask) fix(cfg *config.Config, src, file string, archive *txtar.Archive, res Result) (Result, error) {
+	fixed, err := fixedSource(cfg, src, file, archive)
+	if err == nil && cfg.Write {
+		err = writeBack(cfg, fixed)
+	}
+	if err != nil {
+		fmt.Fprintf(g.messages(), "Error applying fixes: %v\n", err)
+		return res, err
+	}
+	if !cfg.Write {
+		res.Stdout = sourceDiff(cfg, src, fixed)
+		g.print(res.Stdout)
+	}
+	return res, nil
+}
+
+// print shows the output of the fmt and fix commands unless it is part of
+// the report.
+func (g *GoMask) print(s string) {
+	if g.stdout != nil && !g.runReport.enabled() {
+		fmt.Fprint(g.stdout, s)
+	}
+}
+
+// formatSource formats the snippet, or the snippet and the Go files of an
+// archive.
+func formatSource(cfg *config.Config, src string) (string, error) {
+	if !isArchive(cfg, src) {
+		return code.FormatSnippet(cfg, src)
+	}
+	archive := txtar.Parse(src)
+	comment, err := code.FormatSnippet(cfg, archive.Comment)
+	if err != nil {
+		return "", err
+	}
+	archive.Comment = comment
+	for i, f := range archive.Files {
+		if filepath.Ext(f.Name) != ".go" {
+			continue
+		}
+		data, err := format.Source([]byte(f.Data))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", f.Name, err)
+		}
+		archive.Files[i].Data = string(data)
+	}
+	return archive.Format(), nil
+}
+
+// fixedSource returns the source with the snippet taken from the fixed
+// generated file and the files of the archive from its fixed directory.
+func fixedSource(cfg *config.Config, src, file string, archive *txtar.Archive) (string, error) {
+	snippet := src
+	if archive != nil {
+		snippet = archive.Comment
+	}
+	if file != "" {
+		generated, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if snippet, err = code.ExtractSnippet(cfg, snippet, string(generated)); err != nil {
+			return "", err
+		}
+	}
+	if archive == nil {
+		return snippet, nil
+	}
+
+	fixed := &txtar.Archive{Comment: snippet}
+	for _, f := range archive.Files {
+		if filepath.Ext(f.Name) == ".go" {
+			data, err := os.ReadFile(filepath.Join(cfg.Directory, f.Name))
+			if err != nil {
+				return "", err
+			}
+			f.Data = string(data)
+		}
+		fixed.Files = append(fixed.Files, f)
+	}
+	return fixed.Format(), nil
+}
+
+// sourceDiff returns the changes to the source as a unified diff, its line
+// numbers count from the start of the snippet.
+func sourceDiff(cfg *config.Config, src, fixed string) string {
+	name := cfg.Source
+	if name == "" {
+		name = "snippet"
+	}
+	//nolint:errcheck // writing to a strings.Builder doesn't fail
+	d, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(strings.TrimSuffix(src, "\n")),
+		B:        difflib.SplitLines(strings.TrimSuffix(fixed, "\n")),
+		FromFile: name + " (old)",
+		ToFile:   name + " (new)",
+		Context:  3,
+	})
+	return d
+}
+
+// writeBack replaces the snippet in its Markdown block, script or archive
+// file.
+func writeBack(cfg *config.Config, src string) error {
+	if len(cfg.Files) > 0 {
+		return errors.New("snippets combined with files can't be written back")
+	}
+	switch {
+	case cfg.Markdown != "":
+		content, err := os.ReadFile(cfg.Markdown)
+		if err != nil {
+			return err
+		}
+		block, err := markdown.Select(markdown.Parse(string(content)), cfg.Heading, cfg.Block)
+		if err != nil {
+			return err
+		}
+		return writeFile(cfg.Markdown, markdown.ReplaceCode(string(content), block, src))
+	case cfg.Script != "":
+		content, err := os.ReadFile(cfg.Script)
+		if err != nil {
+			return err
+		}
+		// The #! line was blanked for the snippet.
+		if shebang, _, ok := strings.Cut(string(content), "\n"); ok && strings.HasPrefix(shebang, "#!") {
+			src = shebang + "\n" + strings.TrimPrefix(src, "\n")
+		}
+		return writeFile(cfg.Script, src)
+	case cfg.Txtar != "" && cfg.Txtar != config.TxtarCode:
+		return writeFile(cfg.Txtar, src)
+	default:
+		return errors.New("-w needs a Markdown file, script or archive to write to")
+	}
+}
+
+// writeFile replaces the content of the file and keeps its mode.
+func writeFile(path, content string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), info.Mode().Perm())
+}
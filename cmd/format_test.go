@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/cmd"
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFormat(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	var stdout bytes.Buffer
+	gomask := NewGoMask(
+		WithConfig(&config.Config{Command: "fmt", Code: "x:=1\nfmt.Println( x )"}),
+		WithOutput(&stdout, &bytes.Buffer{}),
+	)
+	res, err := gomask.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "x := 1\nfmt.Println(x)\n", res.Stdout)
+	assert.Equal(t, res.Stdout, stdout.String())
+}
+
+func TestRunFormatWrite(t *testing.T) {
+	dir := t.TempDir()
+	md := filepath.Join(dir, "Maskfile.md")
+	require.NoError(t, os.WriteFile(md, []byte("# build\n\n```go\nx:=1\nfmt.Println( x )\n```\n"), 0o640))
+	script := filepath.Join(dir, "hello.gosh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/usr/bin/env go-mask\n//go-mask:mainfunc\nfmt.Println( 1 )\n"), 0o750))
+
+	os.Args = []string{"go-mask"}
+	_, err := NewGoMask(WithConfig(&config.Config{Command: "fmt", Write: true, Markdown: md})).Run()
+	require.NoError(t, err)
+	content, err := os.ReadFile(md)
+	require.NoError(t, err)
+	assert.Equal(t, "# build\n\n```go\nx := 1\nfmt.Println(x)\n```\n", string(content))
+
+	os.Args = []string{"go-mask", "-command", "fmt", "-w", script}
+	_, err = NewGoMask(WithConfig(&config.Config{})).Run()
+	require.NoError(t, err)
+	content, err = os.ReadFile(script)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/usr/bin/env go-mask\n//go-mask:mainfunc\nfmt.Println(1)\n", string(content))
+	info, err := os.Stat(script)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+
+	os.Args = []string{"go-mask"}
+	_, err = NewGoMask(WithConfig(&config.Config{Command: "fmt", Write: true, Code: "x := 1"})).Run()
+	assert.EqualError(t, err, "-w needs a Markdown file, script or archive to write to")
+}
+
+func TestRunFmtError(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	res, err := NewGoMask(WithConfig(&config.Config{Command: "fmt", Source: "Maskfile.md", Line: 3, Code: "x := \n"})).Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Maskfile.md:4:1: expected operand")
+	assert.Equal(t, cmd.StageGenerate, res.Stage)
+}
+
+func TestRunFix(t *testing.T) {
+	dir := t.TempDir()
+	txtar := filepath.Join(dir, "demo.txtar")
+	require.NoError(t, os.WriteFile(txtar, []byte("show(1)\n-- go.mod --\nmodule demo\n\ngo 1.24\n-- show.go --\npackage main\n\nfunc show(v interface{}) { println(v) }\n"), 0o600))
+
+	os.Args = []string{"go-mask"}
+	cfg := &config.Config{Command: "fix", Package: "main", MainFunc: true, Txtar: txtar}
+	cfg.Directory = t.TempDir()
+	res, err := NewGoMask(WithConfig(cfg)).Run()
+	require.NoError(t, err)
+	assert.Contains(t, res.Stdout, "-func show(v interface{}) { println(v) }\n+func show(v any) { println(v) }\n")
+
+	cfg.Directory, cfg.Write = t.TempDir(), true
+	_, err = NewGoMask(WithConfig(cfg)).Run()
+	require.NoError(t, err)
+	content, err := os.ReadFile(txtar)
+	require.NoError(t, err)
+	assert.Equal(t, "show(1)\n-- go.mod --\nmodule demo\n\ngo 1.24\n-- show.go --\npackage main\n\nfunc show(v any) { println(v) }\n", string(content))
+}
+
+func TestRunVet(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	res, err := NewGoMask(WithConfig(&config.Config{
+		Command:   "vet",
+		Package:   "main",
+		MainFunc:  true,
+		Directory: t.TempDir(),
+		Code:      "fmt.Printf(\"%d\\n\", \"x\")\n",
+	})).Run()
+	require.Error(t, err)
+	assert.Equal(t, []cmd.Diagnostic{
+		{File: "snippet", Line: 1, Column: 13, Message: "fmt.Printf format %d has arg \"x\" of wrong type string", Category: cmd.CategoryVet, SnippetLine: 1},
+	}, res.Diagnostics)
+}
@@ -1,25 +1,37 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/fr12k/go-file"
 	"github.com/fr12k/go-mask/pkg/cmd"
 	"github.com/fr12k/go-mask/pkg/code"
 	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/fr12k/go-mask/pkg/expect"
+	"github.com/fr12k/go-mask/pkg/markdown"
+	"github.com/fr12k/go-mask/pkg/txtar"
+	"github.com/fr12k/go-mask/pkg/workspace"
 
 	"gopkg.in/yaml.v3"
 )
 
 type (
 	GoMask struct {
-		loader  *config.Loader
-		reader  func(cfg *config.Config) *code.Reader
-		writer  func(cfg *config.Config) *file.File
-		command *cmd.Command
+		loader    *config.Loader
+		reader    func(cfg *config.Config) *code.Reader
+		writer    func(cfg *config.Config) *file.File
+		command   *cmd.Command
+		stdin     io.Reader
+		stdout    io.Writer
+		runReport *Report
 	}
 
 	Option func(*GoMask)
@@ -27,9 +39,26 @@ type (
 	Result struct {
 		Stdout string
 		Stderr string
+		// ExitCode is the exit code of the go command or the program, zero if
+		// neither of them ran.
+		ExitCode int
+		// Stage is the last stage the run reached, on failure the one that
+		// failed.
+		Stage cmd.Stage
+		// Diagnostics are the errors the go command reported if the
+		// compilation failed.
+		Diagnostics []cmd.Diagnostic
+		// Report is the report printed with -format json, nil otherwise.
+		Report *Report
 	}
 )
 
+// ProgramFailed reports whether the program itself exited with a non zero
+// code, as opposed to go-mask failing before or while compiling it.
+func (r Result) ProgramFailed() bool {
+	return r.Stage == cmd.StageRun && r.ExitCode > 0
+}
+
 func WithConfig(cfg *config.Config) Option {
 	return func(g *GoMask) {
 		//nolint:errcheck // ignore error because we are sure that the config is valid
@@ -38,6 +67,30 @@ func WithConfig(cfg *config.Config) Option {
 	}
 }
 
+// WithOutput streams the output of the program to stdout and stderr while
+// it runs instead of returning it in the Result once it finished.
+func WithOutput(stdout, stderr io.Writer) Option {
+	return func(g *GoMask) {
+		g.stdout = stdout
+		g.command.Stdout = stdout
+		g.command.Stderr = stderr
+	}
+}
+
+// WithStdin passes stdin to the program if the code wasn't read from it.
+func WithStdin(stdin io.Reader) Option {
+	return func(g *GoMask) {
+		g.stdin = stdin
+	}
+}
+
+// WithCapture keeps a copy of the streamed output in the Result.
+func WithCapture() Option {
+	return func(g *GoMask) {
+		g.command.Capture = true
+	}
+}
+
 func NewGoMask(opts ...Option) *GoMask {
 	goMask := &GoMask{
 		loader: config.NewLoader(".go-mask.yml"),
@@ -58,51 +111,470 @@ func NewGoMask(opts ...Option) *GoMask {
 }
 
 func (g *GoMask) Run() (Result, error) {
+	return g.RunContext(context.Background())
+}
+
+// RunContext is like Run but kills the go command and the program it runs
+// when ctx is done.
+func (g *GoMask) RunContext(ctx context.Context) (Result, error) {
+	// A run points the command at its directory, stdin and report, the
+	// copy keeps them out of the next run.
+	if shared := g.command; shared != nil {
+		command := *shared
+		g.command = &command
+		defer func() { g.command = shared }()
+	}
+
+	g.runReport = newReport()
+	res, err := g.run(ctx)
+	if !g.runReport.enabled() {
+		return res, err
+	}
+
+	res.Report = g.runReport
+	if g.stdout != nil {
+		if werr := g.runReport.write(g.stdout, res, err); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return res, err
+}
+
+// run loads the code and config of the snippet and executes it.
+func (g *GoMask) run(ctx context.Context) (Result, error) {
+	cfg, err := g.loadConfig()
+	if err != nil {
+		if config.ArgValue("format") == FormatJSON {
+			g.enableReport()
+		}
+		return Result{Stage: cmd.StageConfig}, err
+	}
+	// The report covers the failures of loading the code as well.
+	if err := g.useConfig(cfg); err != nil {
+		fmt.Fprintf(g.messages(), "Error in config: %v\n", err)
+		return Result{Stage: cmd.StageConfig}, err
+	}
+
+	if cfg.Markdown != "" {
+		if err := loadMarkdown(cfg); err != nil {
+			fmt.Fprintf(g.messages(), "Error reading Markdown: %v\n", err)
+			return Result{Stage: cmd.StageGenerate}, err
+		}
+	}
+	// A file after the flags is a script, e.g. started through its #! line.
+	if cfg.Script != "" {
+		if err := loadScript(cfg); err != nil {
+			fmt.Fprintf(g.messages(), "Error reading script: %v\n", err)
+			return Result{Stage: cmd.StageGenerate}, err
+		}
+		// Scripts run the same anywhere, the command and go flags of a config
+		// file in the current directory are meant for its snippets. The
+		// directives of the script still set them.
+		if config.ArgValue("command") == "" {
+			cfg.Command = "run"
+		}
+		if config.ArgValue("goflags") == "" && config.ArgValue("args") == "" {
+			cfg.GoFlags, cfg.Args = "", ""
+		}
+		// Scripts run anywhere, their generated file shouldn't end up there.
+		dir, err := os.MkdirTemp("", "go-mask-script-*")
+		if err != nil {
+			return Result{Stage: cmd.StageWrite}, err
+		}
+		defer os.RemoveAll(dir)
+		cfg.Directory = dir
+	}
+	if cfg.Txtar != "" {
+		if err := loadTxtar(cfg); err != nil {
+			fmt.Fprintf(g.messages(), "Error reading archive: %v\n", err)
+			return Result{Stage: cmd.StageGenerate}, err
+		}
+	}
+
+	// Formatting the files along with the snippet would mix them up.
+	if len(cfg.Files) > 0 && cfg.Command != "fmt" {
+		if err := loadFiles(cfg); err != nil {
+			fmt.Fprintf(g.messages(), "Error reading files: %v\n", err)
+			return Result{Stage: cmd.StageGenerate}, err
+		}
+	}
+
+	return g.execute(ctx, cfg)
+}
+
+// loadConfig loads the config file and applies the flags on top of it.
+func (g *GoMask) loadConfig() (*config.Config, error) {
 	cfg, err := g.loader.LoadConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(g.messages(), "Error loading config: %v\n", err)
+		return nil, err
 	}
 
 	// Parse flags from config
 	err = config.ApplyFlags(cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating parsing flags from commandline: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(g.messages(), "Error generating parsing flags from commandline: %v\n", err)
+		return nil, err
 	}
+	return cfg, nil
+}
+
+// execute generates, writes and runs the code of the final config.
+func (g *GoMask) execute(ctx context.Context, cfg *config.Config) (Result, error) {
+	g.runReport.mark(cmd.StageConfig)
 
 	// Read the input code
 	reader := g.reader(cfg)
+	src, err := reader.ReadCode()
+	if err != nil {
+		fmt.Fprintf(g.messages(), "Error reading code: %v\n", err)
+		return Result{Stage: cmd.StageGenerate}, err
+	}
 
-	// Generate the Go code
-	generatedCode, err := reader.GenerateGoCode(cfg)
+	// The directives of the snippet override everything but the flags.
+	directives, err := reader.Directives()
+	if err == nil {
+		err = config.ApplyDirectives(cfg, directives)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating Go code: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(g.messages(), "Error applying directives: %v\n", err)
+		return Result{Stage: cmd.StageConfig}, err
+	}
+	if err := g.useConfig(cfg); err != nil {
+		fmt.Fprintf(g.messages(), "Error in config: %v\n", err)
+		return Result{Stage: cmd.StageConfig}, err
+	}
+
+	// Formatting only needs the snippet itself.
+	if cfg.Command == "fmt" {
+		return g.format(cfg, src)
+	}
+
+	if cfg.Isolate {
+		ws, err := g.isolate(ctx, cfg)
+		if err != nil {
+			fmt.Fprintf(g.messages(), "Error creating workspace: %v\n", err)
+			return Result{Stage: cmd.StageConfig}, err
+		}
+		defer ws.Close()
+	}
+
+	// The comment of an archive is the snippet, its files are taken as is.
+	var archive *txtar.Archive
+	if isArchive(cfg, src) {
+		archive = txtar.Parse(src)
+		reader = code.NewReader(strings.NewReader(archive.Comment))
+		// Its files would clobber those of the current directory, a temporary
+		// one inside keeps the surrounding module.
+		if !cfg.Isolate && filepath.Clean(cfg.Directory) == "." {
+			dir, err := os.MkdirTemp(".", ".go-mask-archive-*")
+			if err != nil {
+				fmt.Fprintf(g.messages(), "Error writing archive: %v\n", err)
+				return Result{Stage: cmd.StageWrite}, err
+			}
+			defer os.RemoveAll(dir)
+			cfg.Directory = dir
+		}
+	}
+
+	// Generate the Go code
+	generatedCode := ""
+	if archive == nil || strings.TrimSpace(archive.Comment) != "" {
+		generatedCode, err = reader.GenerateGoCode(cfg)
+		if err != nil {
+			fmt.Fprintf(g.messages(), "Error generating Go code: %v\n", err)
+			return Result{Stage: cmd.StageGenerate}, err
+		}
+	}
+
+	g.runReport.mark(cmd.StageGenerate)
+	if g.runReport.enabled() {
+		g.runReport.Source = generatedCode
 	}
 
 	// Debug mode: print generated code
 	if cfg.Debug {
+		if g.stdout != nil && !g.runReport.enabled() {
+			fmt.Fprint(g.stdout, generatedCode)
+		}
 		return Result{
 			Stdout: generatedCode,
+			Stage:  cmd.StageGenerate,
 		}, nil
 	}
 
 	// Write the generated code to a file
-	writer := g.writer(cfg)
+	var target, file string
+	if generatedCode != "" {
+		writer := g.writer(cfg)
+		_, err = writer.Write([]byte(generatedCode))
+		if err != nil {
+			fmt.Fprintf(g.messages(), "Error writing to file: %v\n", err)
+			return Result{Stage: cmd.StageWrite}, err
+		}
+		target = writer.Writer.FilePath
+		file = target
+	}
 
-	_, err = writer.Write([]byte(generatedCode))
+	// An archive is built as the package of the directory it is written to.
+	if archive != nil {
+		if target, err = g.extract(cfg, archive); err != nil {
+			fmt.Fprintf(g.messages(), "Error writing archive: %v\n", err)
+			return Result{Stage: cmd.StageWrite}, err
+		}
+	}
+
+	stdin, err := g.openStdin(cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing to file: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(g.messages(), "Error opening stdin: %v\n", err)
+		return Result{Stage: cmd.StageWrite}, err
+	}
+	if closer, ok := stdin.(io.Closer); ok {
+		defer closer.Close()
+	}
+	g.command.Stdin = stdin
+	g.runReport.mark(cmd.StageWrite)
+	if g.runReport.enabled() {
+		g.runReport.File = target
+	}
+
+	// The output is checked against the expectations once the program ran.
+	checking := cfg.Update || expect.Enabled(cfg)
+	if checking {
+		g.command.Capture = true
 	}
 
 	// Run the build/run/test command
-	res, err := g.command.ExecuteCommand(cfg, writer.Writer.FilePath)
+	res, err := g.command.ExecuteCommand(ctx, cfg, target)
+	result := toResult(res)
+	g.printDiagnostics(cfg, result)
+	if cfg.Command == "fix" && err == nil {
+		return g.fix(cfg, src, file, archive, result)
+	}
+	if checking && ranProgram(result, err) {
+		err := g.expect(cfg, result)
+		g.runReport.mark(cmd.StageExpect)
+		if err != nil {
+			result.Stage = cmd.StageExpect
+			return result, err
+		}
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// messages returns where the error messages go, nowhere if the command is
+// quiet.
+func (g *GoMask) messages() io.Writer {
+	if g.command != nil && g.command.Quiet {
+		return io.Discard
+	}
+	return os.Stderr
+}
+
+// printDiagnostics prints the diagnostics of a failed compilation in the
+// configured format, unless they are part of the report.
+func (g *GoMask) printDiagnostics(cfg *config.Config, res Result) {
+	if cfg.Diagnostics == "" || len(res.Diagnostics) == 0 || g.stdout == nil || g.runReport.enabled() {
+		return
+	}
+	if err := cmd.WriteDiagnostics(g.stdout, res.Diagnostics, cfg.Diagnostics); err != nil {
+		fmt.Fprintf(g.messages(), "Error printing diagnostics: %v\n", err)
+	}
+}
+
+// loadMarkdown takes the code from the selected block of the Markdown file.
+// The attributes of the block override the config file but not the flags,
+// which are applied again.
+func loadMarkdown(cfg *config.Config) error {
+	content, err := os.ReadFile(cfg.Markdown)
 	if err != nil {
-		return toResult(res), err
+		return err
+	}
+	block, err := markdown.Select(markdown.Parse(string(content)), cfg.Heading, cfg.Block)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(block.Code) == "" {
+		return fmt.Errorf("go block at line %d is empty", block.Start)
+	}
+
+	cfg.Code = block.Code
+	cfg.Source = cfg.Markdown
+	cfg.Line = block.Line()
+	if block.Output != nil {
+		cfg.ExpectStdout = &block.Output.Code
+	}
+	if err := config.ApplyAttributes(cfg, block.Attrs); err != nil {
+		return fmt.Errorf("go block at line %d: %w", block.Start, err)
+	}
+	return config.ApplyFlags(cfg)
+}
+
+// isolate creates the workspace and points the config and the go command at
+// it. Paths given relative to the current directory are made absolute first.
+func (g *GoMask) isolate(ctx context.Context, cfg *config.Config) (*workspace.Workspace, error) {
+	toolchain := ""
+	if cfg.GoVersion == "" {
+		var err error
+		if toolchain, err = g.command.GoVersion(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ws, err := workspace.New(cfg, toolchain)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := absPaths(cfg); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	cfg.Directory = ws.Dir
+	g.command.Dir = ws.Dir
+	return ws, nil
+}
+
+// loadTxtar takes the code from the archive file, the line directive of the
+// snippet in its comment points into it.
+func loadTxtar(cfg *config.Config) error {
+	if cfg.Txtar == config.TxtarCode {
+		return nil
+	}
+	content, err := os.ReadFile(cfg.Txtar)
+	if err != nil {
+		return err
+	}
+	if !txtar.IsArchive(string(content)) {
+		return fmt.Errorf("%s has no files", cfg.Txtar)
 	}
-	return toResult(res), nil
+	cfg.Code = string(content)
+	cfg.Source = cfg.Txtar
+	cfg.Line = 1
+	return nil
+}
+
+// loadFiles adds the files matching the globs of the config to the code.
+// Files with a package clause become files of the archive, the others are
+// appended to the snippet, so the line directive still points into it.
+func loadFiles(cfg *config.Config) error {
+	archive := &txtar.Archive{Comment: cfg.Code}
+	if isArchive(cfg, cfg.Code) {
+		archive = txtar.Parse(cfg.Code)
+	}
+
+	seen := map[string]bool{}
+	for _, pattern := range cfg.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no files match %q", pattern)
+		}
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if !code.HasPackageClause(string(content)) {
+				archive.Comment = joinCode(archive.Comment, string(content))
+				continue
+			}
+			name := filepath.Base(path)
+			if slices.ContainsFunc(archive.Files, func(f txtar.File) bool { return f.Name == name }) {
+				return fmt.Errorf("%s: duplicate file %s in the package", path, name)
+			}
+			archive.Files = append(archive.Files, txtar.File{Name: name, Data: string(content)})
+		}
+	}
+
+	if len(archive.Files) == 0 {
+		cfg.Code = archive.Comment
+		return nil
+	}
+	cfg.Code = archive.Format()
+	if cfg.Txtar == "" {
+		cfg.Txtar = config.TxtarCode
+	}
+	return nil
+}
+
+// isArchive reports whether the code is a txtar archive: one asked for with
+// Txtar or one starting with a file marker. Marker lines further down might
+// be part of a string of the snippet, so they don't count on their own.
+func isArchive(cfg *config.Config, src string) bool {
+	if cfg.Txtar != "" {
+		return txtar.IsArchive(src)
+	}
+	return txtar.StartsWithMarker(src)
+}
+
+// joinCode appends the fragment to the code on a line of its own.
+func joinCode(code, fragment string) string {
+	if code != "" && !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+	return code + fragment
+}
+
+// extract writes the files of the archive into the directory and runs the
+// go command there, so a go.mod of the archive is used. It returns the
+// absolute directory.
+func (g *GoMask) extract(cfg *config.Config, archive *txtar.Archive) (string, error) {
+	dir, err := filepath.Abs(cfg.Directory)
+	if err != nil {
+		return "", err
+	}
+	if err := archive.Extract(dir); err != nil {
+		return "", err
+	}
+	if err := absPaths(cfg); err != nil {
+		return "", err
+	}
+	g.command.Dir = dir
+	return dir, nil
+}
+
+// absPaths makes the paths given relative to the current directory absolute
+// before the go command is run in another one.
+func absPaths(cfg *config.Config) error {
+	for _, path := range []*string{&cfg.Output, &cfg.Stdin, &cfg.CacheDir} {
+		if *path == "" {
+			continue
+		}
+		var err error
+		if *path, err = filepath.Abs(*path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openStdin returns the stdin of the program: the configured file or the
+// stdin of go-mask unless the code was read from it.
+func (g *GoMask) openStdin(cfg *config.Config) (io.Reader, error) {
+	if cfg.Stdin != "" {
+		return os.Open(cfg.Stdin)
+	}
+	if cfg.CodeFromStdin() {
+		return nil, nil //nolint:nilnil // the code used up stdin, the program gets none
+	}
+	return g.stdin, nil
+}
+
+// ranProgram reports whether the program ran to its end, successful or not.
+func ranProgram(res Result, err error) bool {
+	var exitErr *exec.ExitError
+	return err == nil || (res.Stage == cmd.StageRun && errors.As(err, &exitErr))
 }
 
 func toResult(res *cmd.CommandResult) Result {
@@ -110,7 +582,10 @@ func toResult(res *cmd.CommandResult) Result {
 		return Result{}
 	}
 	return Result{
-		Stdout: res.Stdout,
-		Stderr: res.Stderr,
+		Stdout:      res.Stdout,
+		Stderr:      res.Stderr,
+		ExitCode:    res.ExitCode,
+		Stage:       res.Stage,
+		Diagnostics: res.Diagnostics,
 	}
 }
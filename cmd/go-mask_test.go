@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -14,8 +16,10 @@ import (
 	"github.com/fr12k/go-mask/pkg/cmd"
 	"github.com/fr12k/go-mask/pkg/code"
 	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/fr12k/go-mask/pkg/expect"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const yamlConfig = `
@@ -94,7 +98,7 @@ func TestRunErrorApplyFlags(t *testing.T) {
 	cfgLoader := &config.Loader{
 		File: file.NewReaderError(os.ErrClosed),
 	}
-	gomask := GoMask{cfgLoader, nil, nil, nil}
+	gomask := GoMask{loader: cfgLoader}
 	_, err := gomask.Run()
 	assert.Error(t, err)
 }
@@ -113,6 +117,286 @@ func TestRunWithCommandError(t *testing.T) {
 	assert.ErrorIs(t, err, assert.AnError)
 }
 
+func TestRunWithOutput(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	tests := []struct {
+		name     string
+		debug    bool
+		opts     []Option
+		expected Result
+		streamed string
+	}{
+		{
+			name:     "Debug",
+			debug:    true,
+			expected: Result{Stdout: "fmt.Println(\"Hello World\")\n", Stage: cmd.StageGenerate},
+			streamed: "fmt.Println(\"Hello World\")\n",
+		},
+		{
+			name:     "Stream",
+			expected: Result{Stage: cmd.StageRun},
+			streamed: "Hello World\n",
+		},
+		{
+			name:     "StreamAndCapture",
+			opts:     []Option{WithCapture()},
+			expected: Result{Stdout: "Hello World\n", Stage: cmd.StageRun},
+			streamed: "Hello World\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			opts := append([]Option{
+				WithConfig(&config.Config{
+					Command:   "run",
+					Directory: t.TempDir(),
+					Debug:     tt.debug,
+					Code:      "fmt.Println(\"Hello World\")",
+				}),
+				WithOutput(&stdout, &stderr),
+			}, tt.opts...)
+			gomask := NewGoMask(opts...)
+			gomask.command.CommandInterface = MockCommand{
+				command: func(ctx context.Context, name string, _ ...string) *exec.Cmd {
+					if name == "go" {
+						return exec.CommandContext(ctx, "true")
+					}
+					return exec.CommandContext(ctx, "echo", "Hello World")
+				},
+			}
+			res, err := gomask.Run()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res)
+			assert.Equal(t, tt.streamed, stdout.String())
+		})
+	}
+}
+
+func TestProgramFailed(t *testing.T) {
+	assert.True(t, Result{Stage: cmd.StageRun, ExitCode: 3}.ProgramFailed())
+	assert.False(t, Result{Stage: cmd.StageRun}.ProgramFailed())
+	assert.False(t, Result{Stage: cmd.StageCompile, ExitCode: 1}.ProgramFailed())
+}
+
+func TestOpenStdin(t *testing.T) {
+	stdinFile := filepath.Join(t.TempDir(), "stdin.txt")
+	err := os.WriteFile(stdinFile, []byte("from file"), 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected string
+		err      bool
+	}{
+		{
+			name:     "CodeFromFlag",
+			cfg:      &config.Config{Code: "fmt.Println()"},
+			expected: "from stdin",
+		},
+		{
+			name: "CodeFromStdin",
+			cfg:  &config.Config{},
+		},
+		{
+			name:     "StdinFile",
+			cfg:      &config.Config{Stdin: stdinFile},
+			expected: "from file",
+		},
+		{
+			name: "StdinFileMissing",
+			cfg:  &config.Config{Stdin: filepath.Join(t.TempDir(), "missing.txt")},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gomask := NewGoMask(WithStdin(strings.NewReader("from stdin")))
+			stdin, err := gomask.openStdin(tt.cfg)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expected == "" {
+				assert.Nil(t, stdin)
+				return
+			}
+			b, err := io.ReadAll(stdin)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(b))
+		})
+	}
+}
+
+func TestRunIsolate(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	gomask := NewGoMask(WithConfig(
+		&config.Config{
+			Command:   "build",
+			Directory: t.TempDir(),
+			Output:    "out",
+			Isolate:   true,
+			GoVersion: "1.25",
+			Code:      "fmt.Println(\"Hello World\")",
+		},
+	))
+	var dir string
+	var args []string
+	gomask.command.CommandInterface = MockCommand{
+		command: func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+			args = append([]string{name}, arg...)
+			dir = gomask.command.Dir
+			return exec.CommandContext(ctx, "true")
+		},
+	}
+	_, err := gomask.Run()
+	require.NoError(t, err)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "build", "-o", filepath.Join(wd, "out"), filepath.Join(dir, "go-mask.go")}, args)
+	assert.NoDirExists(t, dir, "workspace should be removed after the run")
+}
+
+func TestRunIsolateCache(t *testing.T) {
+	wd := t.TempDir()
+	t.Chdir(wd)
+	os.Args = []string{"go-mask"}
+	cfg := &config.Config{
+		Command:   "run",
+		Package:   "main",
+		MainFunc:  true,
+		Isolate:   true,
+		Cache:     true,
+		CacheDir:  "relcache",
+		GoVersion: "1.25",
+		Code:      "fmt.Println(\"hi\")",
+	}
+	for range 2 {
+		res, err := NewGoMask(WithConfig(cfg)).Run()
+		require.NoError(t, err)
+		assert.Equal(t, "hi\n", res.Stdout)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(wd, "relcache"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the cache directory is relative to the current one")
+}
+
+func TestRunReuse(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Args = []string{"go-mask"}
+	want := "hi"
+	cfg := &config.Config{
+		Command:      "run",
+		Package:      "main",
+		MainFunc:     true,
+		Isolate:      true,
+		GoVersion:    "1.25",
+		Code:         "fmt.Println(\"hi\")",
+		ExpectStdout: &want,
+	}
+	g := NewGoMask(WithConfig(cfg))
+	res, err := g.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "hi\n", res.Stdout)
+	assert.Empty(t, g.command.Dir, "the removed workspace isn't used again")
+	assert.False(t, g.command.Capture)
+
+	cfg.Isolate, cfg.ExpectStdout = false, nil
+	g.loader = NewGoMask(WithConfig(cfg)).loader
+	res, err = g.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "hi\n", res.Stdout)
+}
+
+func TestLoadMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	md := filepath.Join(dir, "Maskfile.md")
+	err := os.WriteFile(md, []byte("## hello\n\n```go mainfunc package=main command=build\nfmt.Println()\n```\n\n## empty\n\n```go\n```\n\n## invalid\n\n```go unknown\nfmt.Println()\n```\n"), 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		args          []string
+		cfg           config.Config
+		expected      config.Config
+		expectedError string
+	}{
+		{
+			name: "AttributesOverrideConfig",
+			args: []string{"go-mask"},
+			cfg:  config.Config{Markdown: md, Heading: "hello", Command: "run"},
+			expected: config.Config{
+				Markdown: md, Heading: "hello", Command: "build", MainFunc: true, Package: "main",
+				Code: "fmt.Println()\n", Source: md, Line: 4,
+			},
+		},
+		{
+			name: "FlagsOverrideAttributes",
+			args: []string{"go-mask", "-command", "test"},
+			cfg:  config.Config{Markdown: md, Heading: "hello"},
+			expected: config.Config{
+				Markdown: md, Heading: "hello", Command: "test", MainFunc: true, Package: "main",
+				Code: "fmt.Println()\n", Source: md, Line: 4,
+			},
+		},
+		{
+			name:          "EmptyBlock",
+			args:          []string{"go-mask"},
+			cfg:           config.Config{Markdown: md, Heading: "empty"},
+			expectedError: "go block at line 9 is empty",
+		},
+		{
+			name:          "InvalidAttribute",
+			args:          []string{"go-mask"},
+			cfg:           config.Config{Markdown: md, Heading: "invalid"},
+			expectedError: "go block at line 14: invalid attribute",
+		},
+		{
+			name:          "MissingFile",
+			args:          []string{"go-mask"},
+			cfg:           config.Config{Markdown: filepath.Join(dir, "missing.md")},
+			expectedError: "no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			cfg := tt.cfg
+			err := loadMarkdown(&cfg)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg)
+		})
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	gomask := NewGoMask(WithConfig(
+		&config.Config{
+			Command:   "run",
+			Directory: t.TempDir(),
+			MainFunc:  true,
+			Package:   "main",
+			Code:      "select {}",
+		},
+	))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := gomask.RunContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestRunErrorReadCode(t *testing.T) {
 	os.Args = []string{"go-mask", "--debug"}
 
@@ -130,12 +414,10 @@ func TestRunErrorReadCode(t *testing.T) {
 				File: file.NewReader(strings.NewReader(yamlConfig)),
 			}
 			gomask := GoMask{
-				cfgLoader,
-				func(_ *config.Config) *code.Reader {
+				loader: cfgLoader,
+				reader: func(_ *config.Config) *code.Reader {
 					return code.NewReader(&errorReader{limit: 0})
 				},
-				nil,
-				nil,
 			}
 			_, err := gomask.Run()
 			assert.Error(t, err)
@@ -164,7 +446,8 @@ func TestRunWriteCode(t *testing.T) {
 	}
 	_, err := gomask.Run()
 	assert.NoError(t, err)
-	assert.Equal(t, "package main\n\nimport \"fmt\"\nimport \"os\"\n\nfunc main() {\nfmt.Println(\"Hello World\")\n}\n", buf.String())
+	directive := (&config.Config{}).LineDirective(1)
+	assert.Equal(t, "package main\n\nimport \"fmt\"\n\nfunc main() {\n"+directive+"fmt.Println(\"Hello World\")\n}\n", buf.String())
 }
 
 func TestRunWriteCodeError(t *testing.T) {
@@ -176,14 +459,13 @@ func TestRunWriteCodeError(t *testing.T) {
 	}
 
 	gomask := GoMask{
-		cfgLoader,
-		func(_ *config.Config) *code.Reader {
+		loader: cfgLoader,
+		reader: func(_ *config.Config) *code.Reader {
 			return code.NewReader(strings.NewReader("fmt.Println(\"Hello World\")"))
 		},
-		func(_ *config.Config) *file.File {
+		writer: func(_ *config.Config) *file.File {
 			return file.NewWriterError(os.ErrClosed)
 		},
-		nil,
 	}
 	_, err := gomask.Run()
 	assert.Error(t, err)
@@ -208,8 +490,8 @@ func (e *errorReader) Read(p []byte) (n int, err error) {
 func NewMockCommand() *cmd.Command {
 	return &cmd.Command{
 		CommandInterface: MockCommand{
-			command: func(_ string, _ ...string) *exec.Cmd {
-				return exec.Command("echo")
+			command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+				return exec.CommandContext(ctx, "echo")
 			},
 		},
 	}
@@ -218,8 +500,8 @@ func NewMockCommand() *cmd.Command {
 func NewMockCommandWithError(err error) *cmd.Command {
 	return &cmd.Command{
 		CommandInterface: MockCommand{
-			command: func(_ string, _ ...string) *exec.Cmd {
-				cmd := exec.Command("echo")
+			command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+				cmd := exec.CommandContext(ctx, "echo")
 				cmd.Err = err
 				return cmd
 			},
@@ -228,9 +510,596 @@ func NewMockCommandWithError(err error) *cmd.Command {
 }
 
 type MockCommand struct {
-	command func(name string, arg ...string) *exec.Cmd
+	command func(ctx context.Context, name string, arg ...string) *exec.Cmd
+}
+
+func (m MockCommand) CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return m.command(ctx, name, arg...)
+}
+
+func TestRunExpect(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".go-mask.yml")
+	err := os.WriteFile(path, []byte(fmt.Sprintf("command: run\ndirectory: %s\nmainfunc: true\npackage: main\nexpect_stdout: Hello\n", dir)), 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		args          []string
+		expectedStage cmd.Stage
+		expectedError error
+	}{
+		{
+			name: "Match",
+			args: []string{"go-mask", "-c", `fmt.Println("Hello")`},
+		},
+		{
+			name:          "Mismatch",
+			args:          []string{"go-mask", "-c", `fmt.Println("Bye")`},
+			expectedStage: cmd.StageExpect,
+			expectedError: expect.ErrMismatch,
+		},
+		{
+			name: "ExpectedExitCode",
+			args: []string{"go-mask", "-expect-exit-code", "3", "-c", `fmt.Println("Hello"); os.Exit(3)`},
+		},
+		{
+			name:          "UnexpectedExitCode",
+			args:          []string{"go-mask", "-c", `fmt.Println("Hello"); os.Exit(3)`},
+			expectedStage: cmd.StageExpect,
+			expectedError: expect.ErrMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			gomask := NewGoMask(WithOutput(&bytes.Buffer{}, &bytes.Buffer{}))
+			gomask.loader = config.NewLoader(path)
+			res, err := gomask.Run()
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Equal(t, tt.expectedStage, res.Stage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "Hello\n", res.Stdout, "the output is captured for the check")
+		})
+	}
+}
+
+func TestRunUpdate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".go-mask.yml")
+	err := os.WriteFile(path, []byte(fmt.Sprintf("command: run\ndirectory: %s\nmainfunc: true\npackage: main\n", dir)), 0o600)
+	require.NoError(t, err)
+
+	os.Args = []string{"go-mask", "-update", "-c", `fmt.Println("Hello"); os.Exit(2)`}
+	gomask := NewGoMask()
+	gomask.loader = config.NewLoader(path)
+	_, err = gomask.Run()
+	require.NoError(t, err)
+
+	cfg, err := config.NewLoader(path).LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello\n", *cfg.ExpectStdout)
+	assert.Equal(t, 2, *cfg.ExpectExitCode)
+	assert.Nil(t, cfg.ExpectStderr)
+
+	md := filepath.Join(dir, "Doc.md")
+	require.NoError(t, os.WriteFile(md, []byte("```go\nfmt.Println(\"Hi\")\n```\n"), 0o600))
+	os.Args = []string{"go-mask", "-update", "-markdown", md}
+	gomask = NewGoMask()
+	gomask.loader = config.NewLoader(path)
+	_, err = gomask.Run()
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(md)
+	require.NoError(t, err)
+	assert.Equal(t, "```go\nfmt.Println(\"Hi\")\n```\n\n```output\nHi\n```\n", string(content))
+}
+
+func TestRunUpdateWithoutConfigFile(t *testing.T) {
+	os.Args = []string{"go-mask", "-update"}
+	gomask := NewGoMask(WithConfig(
+		&config.Config{
+			Command:   "run",
+			Directory: t.TempDir(),
+			MainFunc:  true,
+			Package:   "main",
+			Code:      `fmt.Println("Hello")`,
+		},
+	))
+	res, err := gomask.Run()
+	assert.EqualError(t, err, "no config file to update")
+	assert.Equal(t, cmd.StageExpect, res.Stage)
 }
 
-func (m MockCommand) Command(name string, arg ...string) *exec.Cmd {
-	return m.command(name, arg...)
+func TestRunTxtar(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "demo.txtar")
+	err := os.WriteFile(archive, []byte("greet(name)\n"+
+		"-- go.mod --\nmodule demo\n\ngo 1.25\n"+
+		"-- greet.go --\npackage main\n\nimport \"fmt\"\n\nconst name = \"Gopher\"\n\nfunc greet(name string) { fmt.Println(\"Hello,\", name) }\n"+
+		"-- greet_test.go --\npackage main\n\nimport \"testing\"\n\nfunc TestName(t *testing.T) {\n\tif name != \"Gopher\" {\n\t\tt.Fatal(name)\n\t}\n}\n"), 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		command  config.Command
+		expected string
+	}{
+		{name: "Run", command: "run", expected: "Hello, Gopher\n"},
+		{name: "Test", command: "test", expected: "ok  \tdemo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = []string{"go-mask"}
+			work := t.TempDir()
+			gomask := NewGoMask(WithConfig(
+				&config.Config{
+					Command:   tt.command,
+					Directory: work,
+					MainFunc:  true,
+					Package:   "main",
+					Txtar:     archive,
+				},
+			))
+			res, err := gomask.Run()
+			require.NoError(t, err)
+			assert.Contains(t, res.Stdout, tt.expected, "the go.mod of the archive is used")
+			assert.FileExists(t, filepath.Join(work, "greet.go"))
+		})
+	}
+}
+
+func TestRunTxtarOnlyFiles(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	work := t.TempDir()
+	gomask := NewGoMask(WithConfig(
+		&config.Config{
+			Command:   "run",
+			Directory: work,
+			Code:      "-- go.mod --\nmodule demo\n-- main.go --\npackage main\n\nfunc main() { println(\"files\") }\n",
+		},
+	))
+	res, err := gomask.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "files\n", res.Stderr)
+	assert.NoFileExists(t, filepath.Join(work, "go-mask.go"), "an archive without comment has no snippet")
+}
+
+func TestRunTxtarCurrentDirectory(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	work := t.TempDir()
+	t.Chdir(work)
+	gomod := "module mine\n"
+	require.NoError(t, os.WriteFile("go.mod", []byte(gomod), 0o600))
+	cfg := &config.Config{
+		Command: "run",
+		Code:    "-- go.mod --\nmodule demo\n-- main.go --\npackage main\n\nfunc main() { print(\"archive\") }\n",
+	}
+
+	for _, dir := range []string{"", "."} {
+		cfg.Directory = dir
+		res, err := NewGoMask(WithConfig(cfg)).Run()
+		require.NoError(t, err)
+		assert.Equal(t, "archive", res.Stderr)
+	}
+	data, err := os.ReadFile("go.mod")
+	require.NoError(t, err)
+	assert.Equal(t, gomod, string(data), "the archive is extracted into a temporary directory")
+	entries, err := os.ReadDir(".")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	cfg.Directory = work
+	res, err := NewGoMask(WithConfig(cfg)).Run()
+	assert.EqualError(t, err, filepath.Join(work, "go.mod")+" already exists")
+	assert.Equal(t, cmd.StageWrite, res.Stage)
+	data, err = os.ReadFile("go.mod")
+	require.NoError(t, err)
+	assert.Equal(t, gomod, string(data), "existing files aren't overwritten")
+}
+
+func TestRunTxtarOptIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		txtar    string
+		code     string
+		expected string
+		files    []string
+	}{
+		{
+			name:     "MarkerInRawString",
+			code:     "q := `\n-- users --\nSELECT 1;\n`\nfmt.Print(q)\n",
+			expected: "\n-- users --\nSELECT 1;\n",
+		},
+		{
+			name:     "Config",
+			txtar:    config.TxtarCode,
+			code:     "greet()\n-- go.mod --\nmodule demo\n-- greet.go --\npackage main\n\nfunc greet() { print(\"hi\") }\n",
+			expected: "hi",
+			files:    []string{"go.mod", "greet.go"},
+		},
+		{
+			name:     "Directive",
+			code:     "//go-mask:txtar true\ngreet()\n-- go.mod --\nmodule demo\n-- greet.go --\npackage main\n\nfunc greet() { print(\"hi\") }\n",
+			expected: "hi",
+			files:    []string{"go.mod", "greet.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = []string{"go-mask"}
+			work := t.TempDir()
+			res, err := NewGoMask(WithConfig(&config.Config{
+				Command:   "run",
+				Directory: work,
+				MainFunc:  true,
+				Package:   "main",
+				Txtar:     tt.txtar,
+				Code:      tt.code,
+			})).Run()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res.Stdout+res.Stderr)
+
+			entries, err := os.ReadDir(work)
+			require.NoError(t, err)
+			var names []string
+			for _, e := range entries {
+				if e.Name() != "go-mask.go" {
+					names = append(names, e.Name())
+				}
+			}
+			assert.Equal(t, tt.files, names)
+		})
+	}
+}
+
+func TestRunTxtarError(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	dir := t.TempDir()
+	code := filepath.Join(dir, "code.go")
+	require.NoError(t, os.WriteFile(code, []byte("fmt.Println()\n"), 0o600))
+
+	_, err := NewGoMask(WithConfig(&config.Config{Txtar: code})).Run()
+	assert.EqualError(t, err, code+" has no files")
+
+	_, err = NewGoMask(WithConfig(&config.Config{Directory: dir, Code: "-- /etc/passwd --\n"})).Run()
+	assert.EqualError(t, err, `invalid file name "/etc/passwd" in archive`)
+}
+
+func TestRunScript(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.gosh")
+	err := os.WriteFile(path, []byte("#!/usr/bin/env go-mask\n// debug: prose like this doesn't configure anything\n//go-mask:package main\n//go-mask:mainfunc\n\nfmt.Println(strings.Join(os.Args[1:], \" \"))\n"), 0o700)
+	require.NoError(t, err)
+
+	os.Args = []string{"go-mask", "-timeout", "1m", path, "Ann", "-v", "--", "Bob"}
+	gomask := NewGoMask(WithConfig(&config.Config{Command: "run", Directory: dir}))
+	res, err := gomask.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "Ann -v -- Bob\n", res.Stdout)
+	assert.NoFileExists(t, filepath.Join(dir, "go-mask.go"), "scripts are generated into a temporary directory")
+}
+
+func TestRunScriptConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile(".go-mask.yml", []byte("command: test\nargs: -run=None\n"), 0o600))
+	script := "//go-mask:package main\n//go-mask:mainfunc\n\nfmt.Println(\"hi\")\n"
+	require.NoError(t, os.WriteFile("hello.gosh", []byte("#!/usr/bin/env go-mask\n"+script), 0o700))
+	require.NoError(t, os.WriteFile("check.gosh", []byte("#!/usr/bin/env go-mask\n//go-mask:command check\n"+script), 0o700))
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "ConfigFileIgnored", args: []string{"hello.gosh"}, expected: "hi\n"},
+		{name: "Flag", args: []string{"-command", "check", "hello.gosh"}},
+		{name: "Directive", args: []string{"check.gosh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append([]string{"go-mask"}, tt.args...)
+			res, err := NewGoMask().Run()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res.Stdout)
+		})
+	}
+}
+
+func TestRunScriptError(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.gosh")
+	require.NoError(t, os.WriteFile(empty, []byte("#!/usr/bin/env go-mask\n"), 0o700))
+	invalid := filepath.Join(dir, "invalid.gosh")
+	require.NoError(t, os.WriteFile(invalid, []byte("//go-mask:mainfunc maybe\nfmt.Println()\n"), 0o700))
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedError string
+		stage         cmd.Stage
+	}{
+		{name: "Missing", path: filepath.Join(dir, "missing.gosh"), expectedError: "no such file or directory", stage: cmd.StageGenerate},
+		{name: "Empty", path: empty, expectedError: "script is empty", stage: cmd.StageGenerate},
+		{name: "InvalidDirective", path: invalid, expectedError: "invalid attribute", stage: cmd.StageConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = []string{"go-mask", tt.path}
+			res, err := NewGoMask(WithConfig(&config.Config{Command: "run"})).Run()
+			assert.ErrorContains(t, err, tt.expectedError)
+			assert.Equal(t, tt.stage, res.Stage)
+		})
+	}
+}
+
+func TestRunDirectives(t *testing.T) {
+	os.Args = []string{"go-mask", "-env", "NAME=Gopher"}
+	gomask := NewGoMask(WithConfig(
+		&config.Config{
+			Command:   "build",
+			Directory: t.TempDir(),
+			Code: "//go-mask:command run\n//go-mask:mainfunc\n//go-mask:package main\n//go-mask:env GREETING=Hello\n\n" +
+				"fmt.Println(os.Getenv(\"GREETING\"), os.Getenv(\"NAME\"))\n",
+		},
+	))
+	res, err := gomask.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello Gopher\n", res.Stdout)
+}
+
+func TestRunDirectivesError(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	gomask := NewGoMask(WithConfig(&config.Config{Code: "//go-mask:unknown\nfmt.Println()\n"}))
+	res, err := gomask.Run()
+	assert.EqualError(t, err, "invalid attribute: flag provided but not defined: -unknown")
+	assert.Equal(t, cmd.StageConfig, res.Stage)
+}
+
+func TestRunFiles(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	dir := t.TempDir()
+	helpers := filepath.Join(dir, "helpers")
+	require.NoError(t, os.Mkdir(helpers, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(helpers, "shout.go"), []byte("import \"strings\"\n\nfunc shout(s string) string { return strings.ToUpper(s) }\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(helpers, "whisper.go"), []byte("package main\n\nimport \"strings\"\n\nfunc whisper(s string) string { return strings.ToLower(s) }\n"), 0o600))
+
+	work := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(work, "go.mod"), []byte("module demo\n"), 0o600))
+	gomask := NewGoMask(WithConfig(
+		&config.Config{
+			Command:   "run",
+			Package:   "main",
+			MainFunc:  true,
+			Directory: work,
+			Files:     []string{filepath.Join(helpers, "*.go")},
+			Code:      "import \"strings\"\nfmt.Println(shout(\"a\"), whisper(\"B\"), strings.Repeat(\"c\", 2))\n",
+		},
+	))
+	res, err := gomask.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "A b cc\n", res.Stdout)
+	assert.FileExists(t, filepath.Join(work, "whisper.go"), "files with a package clause are kept separate")
+}
+
+func TestRunFilesCurrentDirectory(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	work := t.TempDir()
+	t.Chdir(work)
+	mine := "package main\n\nfunc main() { println(\"mine\") }\n"
+	require.NoError(t, os.WriteFile("go.mod", []byte("module demo\n\ngo 1.25\n"), 0o600))
+	require.NoError(t, os.WriteFile("main.go", []byte(mine), 0o600))
+	require.NoError(t, os.Mkdir("lib", 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join("lib", "lib.go"), []byte("package lib\n\nconst Name = \"Gopher\"\n"), 0o600))
+	require.NoError(t, os.Mkdir("helpers", 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join("helpers", "main.go"), []byte("package main\n\nimport \"demo/lib\"\n\nfunc greet() string { return lib.Name }\n"), 0o600))
+
+	res, err := NewGoMask(WithConfig(&config.Config{
+		Command:   "run",
+		Package:   "main",
+		MainFunc:  true,
+		Directory: ".",
+		Files:     []string{filepath.Join("helpers", "main.go")},
+		Code:      "fmt.Println(greet())\n",
+	})).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "Gopher\n", res.Stdout, "the files are built in the module of the current directory")
+
+	data, err := os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Equal(t, mine, string(data))
+	entries, err := os.ReadDir(".")
+	require.NoError(t, err)
+	assert.Len(t, entries, 4, "the files and the snippet are written to a temporary directory")
+}
+
+func TestRunFilesError(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	dir := t.TempDir()
+
+	_, err := NewGoMask(WithConfig(&config.Config{Files: []string{filepath.Join(dir, "*.go")}})).Run()
+	assert.EqualError(t, err, fmt.Sprintf("no files match %q", filepath.Join(dir, "*.go")))
+
+	for _, sub := range []string{"a", "b"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, sub), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, sub, "util.go"), []byte("package main\n"), 0o600))
+	}
+	_, err = NewGoMask(WithConfig(&config.Config{Files: []string{filepath.Join(dir, "*", "util.go")}})).Run()
+	assert.EqualError(t, err, filepath.Join(dir, "b", "util.go")+": duplicate file util.go in the package")
+}
+
+func TestRunFormatJSON(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	tests := []struct {
+		name     string
+		script   string
+		stage    cmd.Stage
+		stdout   string
+		diags    []cmd.Diagnostic
+		errorMsg string
+	}{
+		{
+			name:   "Run",
+			script: "true",
+			stage:  cmd.StageRun,
+			stdout: "Hello World\n",
+		},
+		{
+			name:     "CompileError",
+			script:   "echo './snippet:2:13: undefined: y' >&2; exit 1",
+			stage:    cmd.StageCompile,
+			diags:    []cmd.Diagnostic{{File: "snippet", Line: 2, Column: 13, Message: "undefined: y", Category: cmd.CategoryCompile, SnippetLine: 2}},
+			errorMsg: "exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			gomask := NewGoMask(
+				WithConfig(&config.Config{
+					Command:   "run",
+					Directory: t.TempDir(),
+					Format:    "json",
+					Code:      "fmt.Println(\"Hello World\")",
+				}),
+				WithOutput(&stdout, &stderr),
+			)
+			gomask.command.CommandInterface = MockCommand{
+				command: func(ctx context.Context, name string, _ ...string) *exec.Cmd {
+					if name == "go" {
+						return exec.CommandContext(ctx, "sh", "-c", tt.script)
+					}
+					return exec.CommandContext(ctx, "echo", "Hello World")
+				},
+			}
+			res, err := gomask.Run()
+			if tt.errorMsg != "" {
+				assert.EqualError(t, err, tt.errorMsg)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NotNil(t, res.Report)
+			assert.Empty(t, stderr.String(), "the output is part of the report")
+
+			var report map[string]any
+			require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+			assert.Equal(t, string(tt.stage), report["stage"])
+			cfg, ok := report["config"].(map[string]any)
+			require.True(t, ok)
+			assert.Equal(t, "json", cfg["format"])
+			assert.Contains(t, report["source"], "fmt.Println(\"Hello World\")")
+			assert.Contains(t, report["durations_ms"], string(cmd.StageGenerate))
+
+			assert.Equal(t, tt.stage, res.Report.Stage)
+			assert.Equal(t, tt.stdout, res.Report.Stdout)
+			assert.Equal(t, tt.diags, res.Report.Diagnostics)
+			assert.Equal(t, tt.errorMsg, res.Report.Error)
+			assert.Equal(t, "go", res.Report.Commands[0].Args[0])
+			assert.Equal(t, cmd.StageCompile, res.Report.Commands[0].Stage)
+		})
+	}
+}
+
+func TestRunFormatError(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	res, err := NewGoMask(WithConfig(&config.Config{Format: "yaml", Code: "fmt.Println()"})).Run()
+	assert.EqualError(t, err, `unknown format "yaml", use text or json`)
+	assert.Equal(t, cmd.StageConfig, res.Stage)
+	assert.Nil(t, res.Report)
+}
+
+func TestRunFormatJSONLoadError(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		stage    cmd.Stage
+		errorMsg string
+	}{
+		{
+			name:     "Flags",
+			args:     []string{"go-mask", "-format", "json", "-unknown"},
+			stage:    cmd.StageConfig,
+			errorMsg: "flag provided but not defined: -unknown",
+		},
+		{
+			name:     "Markdown",
+			args:     []string{"go-mask", "-format", "json", "-markdown", "missing.md"},
+			stage:    cmd.StageGenerate,
+			errorMsg: "open missing.md: no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			var stdout bytes.Buffer
+			res, err := NewGoMask(
+				WithConfig(&config.Config{}),
+				WithOutput(&stdout, &bytes.Buffer{}),
+			).Run()
+			require.EqualError(t, err, tt.errorMsg)
+			require.NotNil(t, res.Report)
+
+			var report map[string]any
+			require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+			assert.Equal(t, string(tt.stage), report["stage"])
+			assert.Equal(t, tt.errorMsg, report["error"])
+		})
+	}
+}
+
+func TestRunDiagnostics(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	var stdout, stderr bytes.Buffer
+	gomask := NewGoMask(
+		WithConfig(&config.Config{
+			Command:     "run",
+			Directory:   t.TempDir(),
+			Diagnostics: "github",
+			Source:      "Maskfile.md",
+			Line:        10,
+			Code:        "fmt.Println(y)",
+		}),
+		WithOutput(&stdout, &stderr),
+	)
+	gomask.command.CommandInterface = MockCommand{
+		command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, "sh", "-c", "echo './Maskfile.md:10:13: undefined: y' >&2; exit 1")
+		},
+	}
+	res, err := gomask.Run()
+	require.Error(t, err)
+	assert.Len(t, res.Diagnostics, 1)
+	assert.Equal(t, "::error file=Maskfile.md,line=10,col=13,title=go-mask compile::undefined: y\n", stdout.String())
+	assert.Contains(t, stderr.String(), "./Maskfile.md:10:13: undefined: y")
+
+	_, err = NewGoMask(WithConfig(&config.Config{Diagnostics: "xml", Code: "fmt.Println()"})).Run()
+	assert.EqualError(t, err, `unknown diagnostics format "xml", use text, json, github`)
+}
+
+func TestRunCheck(t *testing.T) {
+	os.Args = []string{"go-mask"}
+	gomask := NewGoMask(WithConfig(&config.Config{
+		Command:   "check",
+		Package:   "main",
+		MainFunc:  true,
+		Directory: t.TempDir(),
+		Code:      "fmt.Println(strings.ToUpper(\"a\"))\nfmt.Println(y)\n",
+	}))
+	res, err := gomask.Run()
+	require.ErrorIs(t, err, cmd.ErrCheck)
+	assert.Equal(t, cmd.StageCompile, res.Stage)
+	assert.Equal(t, []cmd.Diagnostic{
+		{File: "snippet", Line: 2, Column: 13, Message: "undefined: y", Category: cmd.CategoryCheck, SnippetLine: 2},
+	}, res.Diagnostics)
 }
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fr12k/go-mask/pkg/cmd"
+	"github.com/fr12k/go-mask/pkg/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type (
+	// Report describes a run for tools consuming the results of go-mask. It
+	// is printed instead of the output of the program with -format json.
+	Report struct {
+		// Config is the resolved config with the keys of the config file.
+		Config map[string]any `json:"config,omitempty"`
+		// Source is the generated code and File the file or package
+		// directory the go command ran on.
+		Source   string       `json:"source,omitempty"`
+		File     string       `json:"file,omitempty"`
+		Commands []Invocation `json:"commands,omitempty"`
+		ExitCode int          `json:"exit_code"`
+		Stage    cmd.Stage    `json:"stage"`
+		// Durations are the milliseconds spent in every stage reached.
+		Durations   map[cmd.Stage]float64 `json:"durations_ms"`
+		Stdout      string                `json:"stdout"`
+		Stderr      string                `json:"stderr"`
+		Diagnostics []cmd.Diagnostic      `json:"diagnostics,omitempty"`
+		Error       string                `json:"error,omitempty"`
+
+		json bool
+		cfg  *config.Config
+		last time.Time
+	}
+
+	// Invocation is a command go-mask ran, with its exact command line.
+	Invocation struct {
+		Stage    cmd.Stage `json:"stage"`
+		Args     []string  `json:"args"`
+		Duration float64   `json:"duration_ms"`
+	}
+)
+
+func newReport() *Report {
+	return &Report{Durations: map[cmd.Stage]float64{}, last: time.Now()}
+}
+
+// useConfig checks the format of the config and records the config if it
+// asks for a report. The output of the program is captured into the report
+// instead of being streamed then.
+func (g *GoMask) useConfig(cfg *config.Config) error {
+	if cfg.Diagnostics != "" && !slices.Contains(cmd.DiagnosticsFormats, cfg.Diagnostics) {
+		return fmt.Errorf("unknown diagnostics format %q, use %s", cfg.Diagnostics, strings.Join(cmd.DiagnosticsFormats, ", "))
+	}
+	switch cfg.Format {
+	case "", FormatText:
+		return nil
+	case FormatJSON:
+	default:
+		return fmt.Errorf("unknown format %q, use %s or %s", cfg.Format, FormatText, FormatJSON)
+	}
+	if g.runReport != nil {
+		g.runReport.cfg = cfg
+		g.enableReport()
+	}
+	return nil
+}
+
+// enableReport prints the report instead of the output of the program, even
+// if the run fails before its config is complete.
+func (g *GoMask) enableReport() {
+	g.runReport.json = true
+	g.command.Stdout, g.command.Stderr = nil, nil
+	g.command.Trace = g.runReport.trace
+}
+
+// enabled reports whether the report is printed.
+func (r *Report) enabled() bool {
+	return r != nil && r.json
+}
+
+// mark adds the time since the previous mark to the stage.
+func (r *Report) mark(stage cmd.Stage) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.Durations[stage] += milliseconds(now.Sub(r.last))
+	r.last = now
+}
+
+// trace records a command the go command ran and the time it took.
+func (r *Report) trace(stage cmd.Stage, args []string, d time.Duration) {
+	r.Commands = append(r.Commands, Invocation{Stage: stage, Args: args, Duration: milliseconds(d)})
+	r.Durations[stage] += milliseconds(d)
+	r.last = time.Now()
+}
+
+// write completes the report with the result of the run and writes it.
+func (r *Report) write(w io.Writer, res Result, err error) error {
+	// The config is missing if it failed to load.
+	if r.cfg != nil {
+		//nolint:errcheck // the config was unmarshaled from YAML already
+		b, _ := yaml.Marshal(r.cfg)
+		if err := yaml.Unmarshal(b, &r.Config); err != nil {
+			return err
+		}
+	}
+	r.ExitCode, r.Stage = res.ExitCode, res.Stage
+	r.Stdout, r.Stderr = res.Stdout, res.Stderr
+	r.Diagnostics = res.Diagnostics
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
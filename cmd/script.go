@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/fr12k/go-mask/pkg/script"
+)
+
+// loadScript takes the code from the script file, the arguments following
+// it are the program arguments. Its directives are applied like those of any
+// snippet.
+func loadScript(cfg *config.Config) error {
+	path := cfg.Script
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	code := script.Parse(string(content))
+	if strings.TrimSpace(code) == "" {
+		return errors.New("script is empty")
+	}
+
+	cfg.Code = code
+	cfg.Source = path
+	cfg.Line = 1
+	return nil
+}
@@ -4,11 +4,9 @@ go 1.25.5
 
 require (
 	github.com/fr12k/go-file v0.0.3
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.11.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-)
+require github.com/davecgh/go-spew v1.1.1 // indirect
@@ -1,18 +1,44 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fr12k/go-mask/cmd"
 )
 
 func main() {
-	res, err := cmd.NewGoMask().Run()
-	fmt.Print(res.Stdout)
-	fmt.Print(res.Stderr)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context) int {
+	if len(os.Args) > 1 && os.Args[1] == "doctest" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		_, err := cmd.NewGoMask(cmd.WithOutput(os.Stdout, os.Stderr)).DocTest(ctx)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	}
+
+	res, err := cmd.NewGoMask(
+		cmd.WithOutput(os.Stdout, os.Stderr),
+		cmd.WithStdin(os.Stdin),
+	).RunContext(ctx)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		// A failing program already reported why, like any other command,
+		// and the report holds the error.
+		if !res.ProgramFailed() && res.Report == nil {
+			fmt.Println(err)
+		}
+		return max(res.ExitCode, 1)
 	}
+	return 0
 }
@@ -58,12 +58,14 @@ func TestCallMain(t *testing.T) {
 }
 
 func TestCallMainError(t *testing.T) {
-	var buf bytes.Buffer
+	var stdout, stderr bytes.Buffer
 	cmd := exec.Command("./"+appName, "-c", "fmt.Println(\"Hello, World!\")")
 	cmd.Env = append(os.Environ(), "GOCOVERDIR=.coverdata")
-	cmd.Stdout = &buf
-	cmd.Stderr = &buf
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 	err := cmd.Run()
 	assert.Error(t, err)
-	assert.Equal(t, "Error executing command: exit status 1\nFAIL\tcommand-line-arguments [setup failed]\nFAIL\n# command-line-arguments\n.go-mask/go-mask_test.go:1:1: expected 'package', found fmt\nexit status 1\n", buf.String())
+	// The streams are read separately, their lines would interleave at random.
+	assert.Equal(t, "FAIL\tcommand-line-arguments [setup failed]\nFAIL\nexit status 1\n", stdout.String())
+	assert.Equal(t, "# command-line-arguments\nsnippet:1:1: expected 'package', found fmt\nError executing command: exit status 1\n", stderr.String())
 }
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+)
+
+// SplitArgs splits s into words following the quoting rules of the POSIX
+// shell: single quotes preserve everything literally, double quotes and
+// backslashes escape the next character. Nothing is expanded, so the words
+// can be passed to a command without a shell being involved.
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		escaped bool
+		quote   rune
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			// Inside double quotes a backslash only escapes characters that are
+			// special there, otherwise it is kept.
+			if quote == '"' && !strings.ContainsRune("\"\\$`\n", r) {
+				word.WriteRune('\\')
+			}
+			if r != '\n' {
+				word.WriteRune(r)
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped {
+		return nil, errors.New("unterminated escape at end of arguments")
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in arguments")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
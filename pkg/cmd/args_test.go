@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     "Empty",
+			args:     "",
+			expected: nil,
+		},
+		{
+			name:     "Fields",
+			args:     " -v  -cover\t-count=1 ",
+			expected: []string{"-v", "-cover", "-count=1"},
+		},
+		{
+			name:     "SingleQuotes",
+			args:     `-ldflags '-X main.version=$(id) "x"'`,
+			expected: []string{"-ldflags", `-X main.version=$(id) "x"`},
+		},
+		{
+			name:     "DoubleQuotes",
+			args:     `-run "Test A\"B\" \x" ""`,
+			expected: []string{"-run", `Test A"B" \x`, ""},
+		},
+		{
+			name:     "Backslash",
+			args:     `path\ with\ spaces a\;b`,
+			expected: []string{"path with spaces", "a;b"},
+		},
+		{
+			name:     "ShellOperatorsAreWords",
+			args:     "-v; rm -rf / && echo",
+			expected: []string{"-v;", "rm", "-rf", "/", "&&", "echo"},
+		},
+		{
+			name:          "UnterminatedQuote",
+			args:          `-run "Test`,
+			expectedError: "unterminated quote",
+		},
+		{
+			name:          "UnterminatedEscape",
+			args:          `-run \`,
+			expectedError: "unterminated escape",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := SplitArgs(tt.args)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, args)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// toolchainEnv are the go env variables that identify the toolchain, the
+// target platform and the module a program is built with.
+var toolchainEnv = []string{
+	"GOVERSION", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64",
+	"GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED", "GOMOD", "GOWORK",
+}
+
+// cacheMaxAge is how long a binary stays in the cache without being used,
+// the same as for the go build cache.
+const cacheMaxAge = 5 * 24 * time.Hour
+
+// DefaultCacheDir returns the directory the built programs are cached in if
+// the config doesn't name one.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-mask"), nil
+}
+
+// cachedBuild returns the cached binary for the source in tmpfile and only
+// calls build if there is none yet. Binaries are built next to the cache
+// entry and renamed into place, so concurrent runs never see a partial one.
+// A hit marks the binary as used, a build removes the binaries that weren't
+// used for cacheMaxAge.
+func (c *Command) cachedBuild(ctx context.Context, cfg *config.Config, goArgs []string, tmpfile string, build func(bin string) error) (string, error) {
+	key, err := c.cacheKey(ctx, goArgs, tmpfile)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute cache key: %w", err)
+	}
+
+	dir := cfg.CacheDir
+	if dir == "" {
+		if dir, err = DefaultCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	bin := filepath.Join(dir, key)
+	if _, err := os.Stat(bin); err == nil {
+		now := time.Now()
+		//nolint:errcheck // an entry that can't be touched is only trimmed earlier
+		_ = os.Chtimes(bin, now, now)
+		return bin, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(dir, "build-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := build(filepath.Join(tmp, "go-mask")); err != nil {
+		return "", err
+	}
+	if err := os.Rename(filepath.Join(tmp, "go-mask"), bin); err != nil {
+		return "", err
+	}
+	return bin, trimCache(dir, time.Now().Add(-cacheMaxAge))
+}
+
+// trimCache removes the binaries and the leftover build directories of
+// interrupted runs last modified before cutoff. Other files in the directory
+// are left alone.
+func trimCache(dir string, cutoff time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !isCacheKey(entry.Name()) && !strings.HasPrefix(entry.Name(), "build-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			// removed by a concurrent run or still in use
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isCacheKey reports whether name is a key made by cacheKey.
+func isCacheKey(name string) bool {
+	b, err := hex.DecodeString(name)
+	return err == nil && len(b) == sha256.Size
+}
+
+// cacheKey hashes everything that goes into the binary: the generated
+// source or every file of the package directory, the go flags, the toolchain
+// identity, the go.mod and go.sum of the module the source is built in and
+// the sources of the packages it imports from outside the module cache.
+func (c *Command) cacheKey(ctx context.Context, goArgs []string, tmpfile string) (string, error) {
+	h := sha256.New()
+
+	if err := writeSource(h, tmpfile); err != nil {
+		return "", err
+	}
+	writeField(h, "args", []byte(strings.Join(goArgs, "\x00")))
+
+	cmd := c.CommandContext(ctx, "go", append([]string{"env", "-json"}, toolchainEnv...)...)
+	cmd.Dir = c.Dir
+	env, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	var vars map[string]string
+	if err := json.Unmarshal(env, &vars); err != nil {
+		return "", err
+	}
+	// The module is identified by its content, not by where it is, so the
+	// temporary modules of isolated runs share their binaries.
+	gomod, root := vars["GOMOD"], ""
+	delete(vars, "GOMOD")
+	//nolint:errcheck // a map of strings always marshals
+	env, _ = json.Marshal(vars)
+	writeField(h, "env", env)
+	if gomod != "" && gomod != os.DevNull {
+		root = filepath.Dir(gomod)
+		for _, name := range []string{gomod, strings.TrimSuffix(gomod, ".mod") + ".sum"} {
+			// go.sum doesn't exist for modules without dependencies
+			if content, err := os.ReadFile(name); err == nil {
+				writeField(h, filepath.Base(name), content)
+			}
+		}
+	}
+
+	if err := c.writeDeps(ctx, h, goArgs, tmpfile, root); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// depsTemplate lists the directory and source files of every dependency that
+// go.sum doesn't pin: packages of the main module, of a workspace and the
+// targets of replace directives.
+const depsTemplate = `{{if and (not .Standard) (or (not .Module) .Module.Main .Module.Replace)}}` +
+	`{{.Dir}}{{range .GoFiles}}{{"\t"}}{{.}}{{end}}{{range .CgoFiles}}{{"\t"}}{{.}}{{end}}` +
+	`{{range .CFiles}}{{"\t"}}{{.}}{{end}}{{range .HFiles}}{{"\t"}}{{.}}{{end}}` +
+	`{{range .SFiles}}{{"\t"}}{{.}}{{end}}{{range .EmbedFiles}}{{"\t"}}{{.}}{{end}}{{end}}`
+
+// writeDeps hashes the sources of the dependencies the go command lists for
+// the source, they change without touching go.mod. Packages that fail to
+// load are listed anyway, the build reports their errors. Files below the
+// root of the module are named relative to it.
+func (c *Command) writeDeps(ctx context.Context, h hash.Hash, goArgs []string, tmpfile, root string) error {
+	args := append(append([]string{"list"}, goArgs...), "-e", "-deps", "-f", depsTemplate, tmpfile)
+	cmd := c.CommandContext(ctx, "go", args...)
+	cmd.Dir = c.Dir
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		dir, files, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		for _, name := range strings.Split(files, "\t") {
+			path := filepath.Join(dir, name)
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if rel, err := filepath.Rel(root, path); root != "" && err == nil && filepath.IsLocal(rel) {
+				path = rel
+			}
+			writeField(h, "dep "+filepath.ToSlash(path), src)
+		}
+	}
+	return nil
+}
+
+// writeSource hashes the file or the files below the directory with their
+// relative names.
+func writeSource(h hash.Hash, path string) error {
+	if !isDir(path) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		writeField(h, "source", src)
+		return nil
+	}
+	return filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, name)
+		if err != nil {
+			return err
+		}
+		writeField(h, "source "+filepath.ToSlash(rel), src)
+		return nil
+	})
+}
+
+func writeField(h hash.Hash, name string, value []byte) {
+	fmt.Fprintf(h, "%s %d\n", name, len(value))
+	h.Write(value)
+}
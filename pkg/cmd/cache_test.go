@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCommandCache(t *testing.T) {
+	dir := t.TempDir()
+	tmpfile := filepath.Join(dir, "go-mask.go")
+	cfg := &config.Config{Command: "run", Cache: true, CacheDir: filepath.Join(dir, "cache")}
+
+	builds := 0
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, name string, args ...string) *exec.Cmd {
+				switch {
+				case name != "go":
+					return exec.CommandContext(ctx, name)
+				case args[0] == "env":
+					return exec.CommandContext(ctx, "echo", `{"GOVERSION": "go1.25.5"}`)
+				case args[0] == "list":
+					return exec.CommandContext(ctx, "true")
+				default:
+					builds++
+					// the fake compiler writes a program printing the number of its build
+					script := `printf '#!/bin/sh\necho build %s\n' "$1" > "$0" && chmod +x "$0"`
+					return exec.CommandContext(ctx, "sh", "-c", script, args[len(args)-2], string(rune('0'+builds)))
+				}
+			},
+		},
+	}
+
+	run := func(src string) *CommandResult {
+		t.Helper()
+		require.NoError(t, os.WriteFile(tmpfile, []byte(src), 0o600))
+		res, err := cmd.ExecuteCommand(context.Background(), cfg, tmpfile)
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.Equal(t, "build 1\n", run("package main").Stdout)
+	assert.Equal(t, "build 1\n", run("package main").Stdout)
+	assert.Equal(t, "build 2\n", run("package main // changed").Stdout)
+	assert.Equal(t, 2, builds)
+
+	entries, err := os.ReadDir(cfg.CacheDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// a hit marks the binary as used, so the next build keeps it
+	old := time.Now().Add(-2 * cacheMaxAge)
+	for _, entry := range entries {
+		require.NoError(t, os.Chtimes(filepath.Join(cfg.CacheDir, entry.Name()), old, old))
+	}
+	assert.Equal(t, "build 1\n", run("package main").Stdout)
+	assert.Equal(t, "build 3\n", run("package main // changed again").Stdout)
+	entries, err = os.ReadDir(cfg.CacheDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestTrimCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-2 * cacheMaxAge)
+	files := map[string]time.Time{
+		strings.Repeat("a", 64): old,
+		strings.Repeat("b", 64): now,
+		"build-1/go-mask":       old,
+		"build-2/go-mask":       now,
+		"notes.txt":             old,
+		strings.Repeat("c", 12): old,
+	}
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+		require.NoError(t, os.Chtimes(filepath.Dir(path), mtime, mtime))
+	}
+
+	require.NoError(t, trimCache(dir, now.Add(-cacheMaxAge)))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{strings.Repeat("b", 64), "build-2", strings.Repeat("c", 12), "notes.txt"}, names)
+}
+
+func TestCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	tmpfile := filepath.Join(dir, "go-mask.go")
+	require.NoError(t, os.WriteFile(tmpfile, []byte("package main"), 0o600))
+	gomod := filepath.Join(dir, "go.mod")
+	require.NoError(t, os.WriteFile(gomod, []byte("module a"), 0o600))
+
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, _ string, args ...string) *exec.Cmd {
+				if args[0] == "list" {
+					return exec.CommandContext(ctx, "true")
+				}
+				return exec.CommandContext(ctx, "echo", `{"GOMOD": "`+gomod+`"}`)
+			},
+		},
+	}
+
+	key, err := cmd.cacheKey(context.Background(), nil, tmpfile)
+	require.NoError(t, err)
+	same, err := cmd.cacheKey(context.Background(), nil, tmpfile)
+	require.NoError(t, err)
+	assert.Equal(t, key, same)
+
+	withArgs, err := cmd.cacheKey(context.Background(), []string{"-race"}, tmpfile)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, withArgs)
+
+	require.NoError(t, os.WriteFile(gomod, []byte("module b"), 0o600))
+	changedModule, err := cmd.cacheKey(context.Background(), nil, tmpfile)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, changedModule)
+
+	_, err = cmd.cacheKey(context.Background(), nil, filepath.Join(dir, "missing.go"))
+	assert.Error(t, err)
+}
+
+func TestCacheKeyPackage(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "testdata"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0o600))
+	data := filepath.Join(dir, "testdata", "input.txt")
+	require.NoError(t, os.WriteFile(data, []byte("one"), 0o600))
+
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, _ string, args ...string) *exec.Cmd {
+				if args[0] == "list" {
+					return exec.CommandContext(ctx, "true")
+				}
+				return exec.CommandContext(ctx, "echo", `{}`)
+			},
+		},
+	}
+
+	key, err := cmd.cacheKey(context.Background(), nil, dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(data, []byte("two"), 0o600))
+	changedData, err := cmd.cacheKey(context.Background(), nil, dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, changedData, "every file of the package is part of the key")
+}
+
+func TestCacheKeyModulePackages(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.24\n"), 0o600))
+	lib := filepath.Join(dir, "lib", "lib.go")
+	require.NoError(t, os.WriteFile(lib, []byte("package lib\n\nfunc Msg() string { return \"one\" }\n"), 0o600))
+	tmpfile := filepath.Join(dir, "go-mask.go")
+	require.NoError(t, os.WriteFile(tmpfile, []byte("package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m/lib\"\n)\n\nfunc main() { fmt.Println(lib.Msg()) }\n"), 0o600))
+
+	cmd := NewCommand()
+	cmd.Dir = dir
+	key, err := cmd.cacheKey(context.Background(), nil, tmpfile)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(lib, []byte("package lib\n\nfunc Msg() string { return \"two\" }\n"), 0o600))
+	changedLib, err := cmd.cacheKey(context.Background(), nil, tmpfile)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, changedLib, "packages of the module are part of the key")
+}
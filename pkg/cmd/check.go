@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// ErrCheck is returned when the check command found errors.
+var ErrCheck = errors.New("type check failed")
+
+// check type checks the generated file, or the package in the directory
+// tmpfile names, in-process instead of building it. Imports are read from
+// their export data, see exportImporter. The errors are printed like the
+// compiler prints them and recorded as diagnostics.
+func (c *Command) check(ctx context.Context, cfg *config.Config, goArgs []string, tmpfile string, res *CommandResult, stderr *bytes.Buffer) error {
+	start := time.Now()
+	files, err := checkFiles(tmpfile)
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	var diags []Diagnostic
+	report := func(pos token.Position, msg string) {
+		diags = append(diags, Diagnostic{File: pos.Filename, Line: pos.Line, Column: pos.Column, Message: msg, Category: CategoryCheck})
+	}
+
+	var parsed []*ast.File
+	for _, path := range files {
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		var list scanner.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				report(e.Pos, e.Msg)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, f)
+	}
+
+	if len(diags) == 0 {
+		imp, err := c.exportImporter(ctx, fset, goArgs, parsed)
+		if err != nil {
+			return err
+		}
+		conf := types.Config{
+			Importer: imp,
+			Error: func(err error) {
+				var terr types.Error
+				if errors.As(err, &terr) {
+					report(fset.Position(terr.Pos), terr.Msg)
+				}
+			},
+		}
+		//nolint:errcheck // every error is reported through conf.Error
+		conf.Check(parsed[0].Name.Name, fset, parsed, nil)
+	}
+	if c.Trace != nil {
+		c.Trace(res.Stage, append([]string{"check"}, files...), time.Since(start))
+	}
+	if len(diags) == 0 {
+		return nil
+	}
+
+	// The compiler sorts its errors by position as well.
+	slices.SortStableFunc(diags, func(a, b Diagnostic) int {
+		return cmp.Or(strings.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	mapDiagnostics(diags, cfg, c.Dir)
+	if err := WriteDiagnostics(c.sink(c.Stderr, stderr), diags, DiagnosticsText); err != nil {
+		return err
+	}
+	res.Diagnostics = diags
+	res.ExitCode = 1
+	return ErrCheck
+}
+
+// checkFiles returns the file to check, or the Go and in-package test files
+// of the directory the go command would build.
+func checkFiles(path string) ([]string, error) {
+	if !isDir(path) {
+		return []string{path}, nil
+	}
+	pkg, err := build.ImportDir(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range slices.Concat(pkg.GoFiles, pkg.TestGoFiles) {
+		files = append(files, filepath.Join(path, name))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", path)
+	}
+	return files, nil
+}
+
+// exportFormat lists the export data file of every package the go command
+// could compile.
+const exportFormat = `{{if .Export}}{{.ImportPath}}{{"\t"}}{{.Export}}{{end}}`
+
+// exportImporter returns an importer reading the export data go list
+// compiles for the imports of the files and their dependencies. It comes
+// from the build cache, so packages like net/http take milliseconds instead
+// of the seconds type checking them from source takes. Imports that fail to
+// compile have no export data and are reported by the type checker.
+func (c *Command) exportImporter(ctx context.Context, fset *token.FileSet, goArgs []string, files []*ast.File) (types.Importer, error) {
+	exports := map[string]string{}
+	var paths []string
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err == nil && path != "C" && path != "unsafe" && !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	if len(paths) > 0 {
+		args := append(append([]string{"list"}, goArgs...), "-e", "-export", "-deps", "-f", exportFormat)
+		cmd := c.CommandContext(ctx, "go", append(args, paths...)...)
+		cmd.Dir = c.Dir
+		out, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return nil, err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if path, export, ok := strings.Cut(line, "\t"); ok {
+				exports[path] = export
+			}
+		}
+	}
+
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		export, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %q", path)
+		}
+		return os.Open(export)
+	}), nil
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCommandCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		target   string
+		expected []Diagnostic
+		stderr   string
+	}{
+		{
+			name:   "Valid",
+			files:  map[string]string{"go-mask.go": "package main\n\nimport \"strings\"\n\nfunc main() { _ = strings.ToUpper(\"a\") }\n"},
+			target: "go-mask.go",
+		},
+		{
+			name:   "TypeErrors",
+			files:  map[string]string{"go-mask.go": "package main\n\nfunc main() {\n//line MASKFILE:10:1\nx := 1\nprintln(y)\n}\n"},
+			target: "go-mask.go",
+			expected: []Diagnostic{
+				{File: "Maskfile.md", Line: 10, Column: 1, Message: "declared and not used: x", Category: CategoryCheck, SnippetLine: 1},
+				{File: "Maskfile.md", Line: 11, Column: 9, Message: "undefined: y", Category: CategoryCheck, SnippetLine: 2},
+			},
+			stderr: "Maskfile.md:10:1: declared and not used: x\nMaskfile.md:11:9: undefined: y\n",
+		},
+		{
+			name:   "SyntaxError",
+			files:  map[string]string{"go-mask.go": "package main\n\nfunc main() {\n//line MASKFILE:10:1\nx := \n}\n"},
+			target: "go-mask.go",
+			expected: []Diagnostic{
+				{File: "Maskfile.md", Line: 11, Column: 1, Message: "expected operand, found '}'", Category: CategoryCheck, SnippetLine: 2},
+			},
+			stderr: "Maskfile.md:11:1: expected operand, found '}'\n",
+		},
+		{
+			name:   "MissingImport",
+			files:  map[string]string{"go-mask.go": "package main\n\n//line MASKFILE:10:1\nimport \"example.com/missing\"\n\nfunc main() { missing.Run() }\n"},
+			target: "go-mask.go",
+			expected: []Diagnostic{
+				{File: "Maskfile.md", Line: 10, Column: 8, Message: "could not import example.com/missing (no export data for \"example.com/missing\")", Category: CategoryCheck, SnippetLine: 1},
+			},
+			stderr: "Maskfile.md:10:8: could not import example.com/missing (no export data for \"example.com/missing\")\n",
+		},
+		{
+			name: "Package",
+			files: map[string]string{
+				"go-mask.go": "package main\n\nfunc main() { greet() }\n",
+				"greet.go":   "package main\n\nfunc greet() {}\n",
+				"notes.txt":  "not go",
+			},
+			target: ".",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			wd, err := os.Getwd()
+			require.NoError(t, err)
+			for name, data := range tt.files {
+				data = strings.ReplaceAll(data, "MASKFILE", filepath.Join(wd, "Maskfile.md"))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+			}
+
+			var stderr bytes.Buffer
+			cmd := Command{CommandInterface: ExecCommand{}, Dir: dir, Stderr: &stderr}
+			cfg := &config.Config{Command: "check", Source: "Maskfile.md", Line: 10}
+			res, err := cmd.ExecuteCommand(context.Background(), cfg, filepath.Join(dir, tt.target))
+			assert.Equal(t, tt.expected, res.Diagnostics)
+			assert.Equal(t, StageCompile, res.Stage)
+			if tt.expected == nil {
+				require.NoError(t, err)
+				assert.Empty(t, stderr.String())
+				return
+			}
+			require.ErrorIs(t, err, ErrCheck)
+			assert.Equal(t, 1, res.ExitCode)
+			assert.Equal(t, tt.stderr, stderr.String())
+		})
+	}
+}
+
+// BenchmarkExecuteCommandCheck measures checking a snippet with a large
+// import, the export data of net/http is compiled once into the build cache.
+func BenchmarkExecuteCommandCheck(b *testing.B) {
+	tmpfile := filepath.Join(b.TempDir(), "go-mask.go")
+	src := "package main\n\nimport \"net/http\"\n\nfunc main() { _ = http.ListenAndServe(\":8080\", nil) }\n"
+	require.NoError(b, os.WriteFile(tmpfile, []byte(src), 0o600))
+	cmd := Command{CommandInterface: ExecCommand{}, Dir: filepath.Dir(tmpfile)}
+	cfg := &config.Config{Command: "check"}
+
+	for b.Loop() {
+		_, err := cmd.ExecuteCommand(context.Background(), cfg, tmpfile)
+		require.NoError(b, err)
+	}
+}
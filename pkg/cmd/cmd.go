@@ -2,34 +2,86 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fr12k/go-mask/pkg/config"
 )
 
+// ErrTimeout is returned when the command didn't finish within the
+// configured timeout.
+var ErrTimeout = errors.New("command timed out")
+
+// waitDelay is how long a command has to stop after it was interrupted
+// before it is killed.
+const waitDelay = time.Second
+
+// Stages a go-mask run goes through, the result records the last one reached.
+const (
+	StageConfig   Stage = "config"
+	StageGenerate Stage = "generate"
+	StageWrite    Stage = "write"
+	StageCompile  Stage = "compile"
+	StageRun      Stage = "run"
+	StageExpect   Stage = "expect"
+)
+
 type (
+	Stage string
+
 	CommandInterface interface {
-		Command(name string, arg ...string) *exec.Cmd
+		CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd
 	}
 
 	ExecCommand struct{}
 
 	Command struct {
 		CommandInterface
+
+		// Dir is the working directory of the go command, the current one if
+		// empty.
+		Dir string
+		// Stdin is passed to the program started by the run command.
+		Stdin io.Reader
+		// Stdout and Stderr receive the output of the command while it runs.
+		// Without them the output is only captured into the CommandResult.
+		Stdout io.Writer
+		Stderr io.Writer
+		// Capture keeps a copy of the streamed output in the CommandResult.
+		Capture bool
+		// Quiet keeps the error messages off stderr, they are returned all
+		// the same.
+		Quiet bool
+		// Trace is called with the stage, the command line and the duration
+		// of every command once it finished.
+		Trace func(stage Stage, args []string, d time.Duration)
+
+		// tool collects the stderr of the go command for its diagnostics.
+		tool *bytes.Buffer
+		// detach starts the commands in a process group of their own.
+		detach bool
 	}
 
 	CommandResult struct {
-		Stdout string
-		Stderr string
+		Stdout   string
+		Stderr   string
+		ExitCode int
+		Stage    Stage
+		// Diagnostics are the errors the go command reported if the
+		// compilation failed, positions in the snippet point at its source.
+		Diagnostics []Diagnostic
 	}
 )
 
-func (m ExecCommand) Command(name string, arg ...string) *exec.Cmd {
-	return exec.Command(name, arg...)
+func (m ExecCommand) CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, arg...)
 }
 
 func NewCommand() *Command {
@@ -39,52 +91,242 @@ func NewCommand() *Command {
 	return cmd
 }
 
-func (c Command) Command(name string, arg ...string) *exec.Cmd {
-	return c.CommandInterface.Command(name, arg...)
+func (c Command) CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return c.CommandInterface.CommandContext(ctx, name, arg...)
 }
 
-func (c *Command) ExecuteCommand(cfg *config.Config, tmpfile string) (*CommandResult, error) {
-	args := []string{"go", cfg.Command.Name()}
-	if cfg.Args != "" {
-		args = append(args, strings.Fields(cfg.Args)...)
+// ExecuteCommand runs the configured go command on tmpfile, the generated
+// file, or on the package in the directory tmpfile names.
+func (c *Command) ExecuteCommand(ctx context.Context, cfg *config.Config, tmpfile string) (*CommandResult, error) {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	res := &CommandResult{Stage: StageCompile}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	defer func() {
+		res.Stdout = stdout.String()
+		res.Stderr = stderr.String()
+	}()
+
+	c.tool = &bytes.Buffer{}
+	defer func() { c.tool = nil }()
+	// Processes outside the foreground group of the terminal are stopped when
+	// they read from it, so only a timeout detaches them.
+	c.detach = cfg.Timeout > 0
+	defer func() { c.detach = false }()
+
+	err := c.executeCommand(ctx, cfg, tmpfile, res, stdout, stderr)
+	if err == nil {
+		return res, nil
+	}
+	if res.Stage == StageCompile && res.Diagnostics == nil {
+		category := CategoryCompile
+		if cfg.Command == "vet" {
+			category = CategoryVet
+		}
+		res.Diagnostics = ParseDiagnostics(c.tool.String(), category)
+		mapDiagnostics(res.Diagnostics, cfg, c.Dir)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("%w after %s", ErrTimeout, cfg.Timeout)
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case res.Stage == StageRun && errors.As(err, &exitErr):
+		// The program reports its own failures, like a shell command would.
+		return res, err
+	}
+	fmt.Fprintf(c.messages(), "Error executing command: %v\n", err)
+	return res, err
+}
+
+func (c *Command) executeCommand(ctx context.Context, cfg *config.Config, tmpfile string, res *CommandResult, stdout, stderr *bytes.Buffer) error {
+	goArgs, err := goFlags(cfg)
+	if err != nil {
+		fmt.Fprintf(c.messages(), "Error parsing args: %v\n", err)
+		return err
+	}
+	args := append([]string{cfg.Command.Name()}, goArgs...)
+
+	// The go.sum of an isolated workspace has to be filled for requirements.
+	if cfg.Isolate && (len(cfg.Require) > 0 || len(cfg.Replace) > 0) {
+		if err := c.execute(ctx, res, nil, nil, c.sink(c.Stdout, stdout), c.sink(c.Stderr, stderr), "go", "mod", "tidy"); err != nil {
+			return err
+		}
 	}
 
 	switch cfg.Command {
 	case "test":
-		dir := filepath.Dir(tmpfile)
-		files, err := listFilesWithSuffix(dir, ".go", "test.go")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing files: %v\n", err)
-			return nil, err
+		if isDir(tmpfile) {
+			args = append(args, tmpfile)
+		} else {
+			dir := filepath.Dir(tmpfile)
+			files, err := listFilesWithSuffix(dir, ".go", "test.go")
+			if err != nil {
+				fmt.Fprintf(c.messages(), "Error listing files: %v\n", err)
+				return err
+			}
+			args = append(args, tmpfile)
+			args = append(args, files...)
 		}
-		args = append(args, tmpfile)
-		args = append(args, files...)
+		if len(cfg.ProgramArgs) > 0 {
+			args = append(append(args, "-args"), cfg.ProgramArgs...)
+		}
+
+		// go test compiles and runs in one go, its output tells which failed.
+		build := &buildFailure{}
+		err = c.execute(ctx, res, nil, cfg.Env, io.MultiWriter(c.sink(c.Stdout, stdout), build), c.sink(c.Stderr, stderr), "go", args...)
+		if err != nil && !build.failed {
+			res.Stage = StageRun
+		}
+		return err
 	case "build":
 		args = append(args, "-o", cfg.Output, tmpfile)
 	case "run":
+		return c.run(ctx, cfg, goArgs, tmpfile, res, stdout, stderr)
+	case "check":
+		return c.check(ctx, cfg, goArgs, tmpfile, res, stderr)
+	case "vet", "fix":
 		args = append(args, tmpfile)
 	}
 
-	cmdStr := strings.Join(args, " ")
-	cmd := c.Command("sh", "-c", cmdStr)
+	return c.execute(ctx, res, nil, nil, c.sink(c.Stdout, stdout), c.sink(c.Stderr, stderr), "go", args...)
+}
 
-	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+// goFlags returns the go flags of the config.
+func goFlags(cfg *config.Config) ([]string, error) {
+	var flags []string
+	for _, s := range []string{cfg.GoFlags, cfg.Args} {
+		words, err := SplitArgs(s)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, words...)
+	}
+	return flags, nil
+}
+
+// run builds the program and executes the binary itself, go run would
+// replace the exit code of the program with its own.
+func (c *Command) run(ctx context.Context, cfg *config.Config, goArgs []string, tmpfile string, res *CommandResult, stdout, stderr *bytes.Buffer) error {
+	build := func(bin string) error {
+		args := append(append([]string{"build"}, goArgs...), "-o", bin, tmpfile)
+		return c.execute(ctx, res, nil, nil, c.sink(c.Stdout, stdout), c.sink(c.Stderr, stderr), "go", args...)
+	}
+
+	var bin string
+	if cfg.Cache {
+		var err error
+		if bin, err = c.cachedBuild(ctx, cfg, goArgs, tmpfile, build); err != nil {
+			return err
+		}
+	} else {
+		dir, err := os.MkdirTemp("", "go-mask-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
 
+		bin = filepath.Join(dir, "go-mask")
+		if err := build(bin); err != nil {
+			return err
+		}
+	}
+
+	res.Stage = StageRun
+	return c.execute(ctx, res, c.Stdin, cfg.Env, c.sink(c.Stdout, stdout), c.sink(c.Stderr, stderr), bin, cfg.ProgramArgs...)
+}
+
+// execute runs a single command and records its exit code. The env is added
+// to the environment of go-mask. When ctx is done the command is interrupted
+// and killed if it didn't stop within waitDelay, along with its process group
+// if it has one.
+func (c *Command) execute(ctx context.Context, res *CommandResult, stdin io.Reader, env []string, stdout, stderr io.Writer, name string, args ...string) error {
+	cmd := c.CommandContext(ctx, name, args...)
+	cmd.Dir = c.Dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if c.detach {
+		setProcessGroup(cmd)
+	}
+	cmd.Cancel = func() error {
+		return interruptProcess(cmd)
+	}
+	cmd.WaitDelay = waitDelay
+	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
+	if c.tool != nil && res.Stage == StageCompile {
+		cmd.Stderr = io.MultiWriter(stderr, c.tool)
+	}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error executing command: %v\n", err)
-		return &CommandResult{
-			Stdout: stdout.String(),
-			Stderr: stderr.String(),
-		}, err
+	start := time.Now()
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		//nolint:errcheck // the group is usually gone already
+		killProcessGroup(cmd)
+	}
+	if c.Trace != nil {
+		c.Trace(res.Stage, append([]string{name}, args...), time.Since(start))
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
 	}
+	return err
+}
+
+// GoVersion returns the version of the go toolchain, e.g. go1.25.5.
+func (c *Command) GoVersion(ctx context.Context) (string, error) {
+	cmd := c.CommandContext(ctx, "go", "env", "GOVERSION")
+	cmd.Dir = c.Dir
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// messages returns where the error messages go.
+func (c *Command) messages() io.Writer {
+	if c.Quiet {
+		return io.Discard
+	}
+	return os.Stderr
+}
+
+// sink returns where the command output goes: the stream, the capture
+// buffer or both of them.
+func (c *Command) sink(stream io.Writer, buf *bytes.Buffer) io.Writer {
+	switch {
+	case stream == nil:
+		return buf
+	case c.Capture:
+		return io.MultiWriter(stream, buf)
+	default:
+		return stream
+	}
+}
+
+// buildFailure watches the output of go test for packages that failed to
+// build.
+type buildFailure struct {
+	failed bool
+}
+
+func (b *buildFailure) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("[build failed]")) || bytes.Contains(p, []byte("[setup failed]")) {
+		b.failed = true
+	}
+	return len(p), nil
+}
 
-	return &CommandResult{
-		Stdout: stdout.String(),
-		Stderr: stderr.String(),
-	}, nil
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
 }
 
 func listFilesWithSuffix(dir, suffix, excludeSuffix string) ([]string, error) {
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fr12k/go-mask/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -16,7 +19,7 @@ func TestNewCommand(t *testing.T) {
 	cmd := NewCommand()
 	assert.NotNil(t, cmd)
 
-	c := cmd.Command("echo")
+	c := cmd.CommandContext(context.Background(), "echo")
 	assert.NotNil(t, c)
 }
 
@@ -56,6 +59,15 @@ func TestExecuteCommand(t *testing.T) {
 			tmpfile:       "testfile.go",
 			expectedError: false,
 		},
+		{
+			name: "ExecuteCommand_UnterminatedQuote",
+			cfg: &config.Config{
+				Command: "run",
+				Args:    "-ldflags 'unterminated",
+			},
+			tmpfile:       "testfile.go",
+			expectedError: true,
+		},
 		{
 			name: "ExecuteCommand_Error",
 			cfg: &config.Config{
@@ -81,29 +93,40 @@ func TestExecuteCommand(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			execCommand := func(name string, args ...string) *exec.Cmd {
-				assert.Equal(t, "sh", name)
+			execCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+				// run executes the binary it built before
+				if tt.cfg.Command == "run" && name != "go" {
+					assert.Equal(t, "go-mask", filepath.Base(name))
+					assert.Empty(t, args)
+					return exec.CommandContext(ctx, "echo")
+				}
+				assert.Equal(t, "go", name)
 				if tt.cfg.Command == "test" {
-					assert.Equal(t, "-c go test arg1 arg2 testfile.go cmd.go", strings.Join(args, " "))
+					// the remaining arguments are the non test files of this package
+					assert.Equal(t, []string{"test", "arg1", "arg2", "testfile.go"}, args[:4])
+					assert.Contains(t, args[4:], "cmd.go")
+					assert.NotContains(t, args[4:], "cmd_test.go")
 				}
 				if tt.cfg.Command == "build" {
-					assert.Equal(t, "-c go build arg1 arg2 -o outputfile testfile.go", strings.Join(args, " "))
+					assert.Equal(t, []string{"build", "arg1", "arg2", "-o", "outputfile", "testfile.go"}, args)
 				}
 				if tt.cfg.Command == "run" {
-					assert.Equal(t, "-c go run arg1 arg2 testfile.go", strings.Join(args, " "))
+					assert.Equal(t, []string{"build", "arg1", "arg2", "-o"}, args[:4])
+					assert.Equal(t, "go-mask", filepath.Base(args[4]))
+					assert.Equal(t, "testfile.go", args[5])
 				}
 				if tt.cfg.Command == "error" {
-					return exec.Command("")
+					return exec.CommandContext(ctx, "")
 				}
-				return exec.Command("echo")
+				return exec.CommandContext(ctx, "echo")
 			}
 			// Execute the command
 			cmd := Command{
-				MockCommand{
+				CommandInterface: MockCommand{
 					command: execCommand,
 				},
 			}
-			_, err := cmd.ExecuteCommand(tt.cfg, tt.tmpfile)
+			_, err := cmd.ExecuteCommand(context.Background(), tt.cfg, tt.tmpfile)
 
 			// Assert if the error matches the expectation
 			if tt.expectedError {
@@ -189,11 +212,11 @@ func TestListFilesWithSuffix(t *testing.T) {
 // test utility
 
 type MockCommand struct {
-	command func(name string, arg ...string) *exec.Cmd
+	command func(ctx context.Context, name string, arg ...string) *exec.Cmd
 }
 
-func (m MockCommand) Command(name string, arg ...string) *exec.Cmd {
-	return m.command(name, arg...)
+func (m MockCommand) CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return m.command(ctx, name, arg...)
 }
 
 func WriteTestFile(t *testing.T, dir, file, content string) {
@@ -201,3 +224,308 @@ func WriteTestFile(t *testing.T, dir, file, content string) {
 	err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o600)
 	require.NoError(t, err)
 }
+
+func TestExecuteCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		timeout time.Duration
+		err     error
+	}{
+		{
+			name:    "Timeout",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			timeout: 100 * time.Millisecond,
+			err:     ErrTimeout,
+		},
+		{
+			name: "Canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(100*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			err: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			// The shell mimics go run which keeps the compiled program as a child.
+			cmd := Command{
+				CommandInterface: MockCommand{
+					command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+						return exec.CommandContext(ctx, "sh", "-c", "sleep 30 & wait")
+					},
+				},
+			}
+			start := time.Now()
+			_, err := cmd.ExecuteCommand(ctx, &config.Config{Command: "run", Timeout: tt.timeout}, "testfile.go")
+			assert.ErrorIs(t, err, tt.err)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
+
+func TestExecuteCommandInterrupt(t *testing.T) {
+	// The background sleep ignores SIGINT like in any non-interactive shell
+	// and is only stopped by killing the process group.
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+				return exec.CommandContext(ctx, "sh", "-c", "trap 'echo cleanup; exit 3' INT; sleep 30 & wait")
+			},
+		},
+	}
+	start := time.Now()
+	res, err := cmd.ExecuteCommand(context.Background(), &config.Config{Command: "build", Timeout: 200 * time.Millisecond}, "testfile.go")
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, "cleanup\n", res.Stdout)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecuteCommandStreaming(t *testing.T) {
+	tests := []struct {
+		name     string
+		capture  bool
+		stream   bool
+		expected CommandResult
+	}{
+		{
+			name:     "CaptureOnly",
+			expected: CommandResult{Stdout: "out\n", Stderr: "err\n", Stage: StageCompile},
+		},
+		{
+			name:     "StreamOnly",
+			stream:   true,
+			expected: CommandResult{Stage: StageCompile},
+		},
+		{
+			name:     "StreamAndCapture",
+			stream:   true,
+			capture:  true,
+			expected: CommandResult{Stdout: "out\n", Stderr: "err\n", Stage: StageCompile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := Command{
+				CommandInterface: MockCommand{
+					command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+						return exec.CommandContext(ctx, "sh", "-c", "echo out; echo err >&2")
+					},
+				},
+				Capture: tt.capture,
+			}
+			if tt.stream {
+				cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			}
+			res, err := cmd.ExecuteCommand(context.Background(), &config.Config{Command: "build", Output: "out"}, "testfile.go")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *res)
+			if tt.stream {
+				assert.Equal(t, "out\n", stdout.String())
+				assert.Equal(t, "err\n", stderr.String())
+			}
+		})
+	}
+}
+
+func TestExecuteCommandExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  config.Command
+		script   func(name string) string
+		stdin    string
+		exitCode int
+		stage    Stage
+	}{
+		{
+			name:    "CompileError",
+			command: "run",
+			script: func(_ string) string {
+				return "exit 1"
+			},
+			exitCode: 1,
+			stage:    StageCompile,
+		},
+		{
+			name:    "ProgramExitCode",
+			command: "run",
+			script: func(name string) string {
+				if name == "go" {
+					return "exit 0"
+				}
+				return "read line; echo $line; exit 3"
+			},
+			stdin:    "hello\n",
+			exitCode: 3,
+			stage:    StageRun,
+		},
+		{
+			name:    "TestBuildFailed",
+			command: "test",
+			script: func(_ string) string {
+				return "echo 'FAIL\tcommand-line-arguments [build failed]'; exit 1"
+			},
+			exitCode: 1,
+			stage:    StageCompile,
+		},
+		{
+			name:    "TestFailed",
+			command: "test",
+			script: func(_ string) string {
+				return "echo '--- FAIL: TestSnippet'; exit 1"
+			},
+			exitCode: 1,
+			stage:    StageRun,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := Command{
+				CommandInterface: MockCommand{
+					command: func(ctx context.Context, name string, _ ...string) *exec.Cmd {
+						return exec.CommandContext(ctx, "sh", "-c", tt.script(name))
+					},
+				},
+				Stdin: strings.NewReader(tt.stdin),
+			}
+			res, err := cmd.ExecuteCommand(context.Background(), &config.Config{Command: tt.command}, "testfile.go")
+			assert.Error(t, err)
+			assert.Equal(t, tt.exitCode, res.ExitCode)
+			assert.Equal(t, tt.stage, res.Stage)
+			if tt.stdin != "" {
+				assert.Equal(t, tt.stdin, res.Stdout)
+			}
+		})
+	}
+}
+
+func TestExecuteCommandIsolate(t *testing.T) {
+	dir := t.TempDir()
+	var calls [][]string
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, name string, args ...string) *exec.Cmd {
+				calls = append(calls, append([]string{name}, args...))
+				return exec.CommandContext(ctx, "pwd")
+			},
+		},
+		Dir: dir,
+	}
+	cfg := &config.Config{Command: "build", Output: "out", Isolate: true, Require: []string{"example.com/lib v1.0.0"}}
+	res, err := cmd.ExecuteCommand(context.Background(), cfg, "testfile.go")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"go", "mod", "tidy"},
+		{"go", "build", "-o", "out", "testfile.go"},
+	}, calls)
+	assert.Equal(t, dir+"\n"+dir+"\n", res.Stdout)
+}
+
+func TestGoVersion(t *testing.T) {
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, _ string, args ...string) *exec.Cmd {
+				assert.Equal(t, []string{"env", "GOVERSION"}, args)
+				return exec.CommandContext(ctx, "echo", "go1.25.5")
+			},
+		},
+	}
+	version, err := cmd.GoVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "go1.25.5", version)
+}
+
+func TestExecuteCommandProgramArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		tmpfile  string
+		expected [][]string
+	}{
+		{
+			name:    "Run",
+			cfg:     &config.Config{Command: "run", GoFlags: "-race", Args: "-v", ProgramArgs: []string{"-v", "a b"}},
+			tmpfile: "go-mask.go",
+			expected: [][]string{
+				{"go", "build", "-race", "-v", "-o", "go-mask", "go-mask.go"},
+				{"go-mask", "-v", "a b"},
+			},
+		},
+		{
+			name:    "Test",
+			cfg:     &config.Config{Command: "test", GoFlags: "-v", ProgramArgs: []string{"-update"}},
+			tmpfile: "go-mask_test.go",
+			expected: [][]string{
+				{"go", "test", "-v", "go-mask_test.go", "-args", "-update"},
+			},
+		},
+		{
+			name:    "Build",
+			cfg:     &config.Config{Command: "build", GoFlags: "-v", Output: "out", ProgramArgs: []string{"ignored"}},
+			tmpfile: "go-mask.go",
+			expected: [][]string{
+				{"go", "build", "-v", "-o", "out", "go-mask.go"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tmpfile := filepath.Join(dir, tt.tmpfile)
+			require.NoError(t, os.WriteFile(tmpfile, []byte("package main"), 0o600))
+
+			var commands [][]string
+			cmd := Command{
+				CommandInterface: MockCommand{
+					command: func(ctx context.Context, name string, args ...string) *exec.Cmd {
+						command := append([]string{filepath.Base(name)}, args...)
+						for i, arg := range command {
+							if filepath.IsAbs(arg) {
+								command[i] = filepath.Base(arg)
+							}
+						}
+						commands = append(commands, command)
+						return exec.CommandContext(ctx, "true")
+					},
+				},
+			}
+			_, err := cmd.ExecuteCommand(context.Background(), tt.cfg, tmpfile)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, commands)
+		})
+	}
+}
+
+func TestExecuteCommandTrace(t *testing.T) {
+	var traced [][]string
+	var stages []Stage
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+				return exec.CommandContext(ctx, "true")
+			},
+		},
+		Trace: func(stage Stage, args []string, d time.Duration) {
+			stages = append(stages, stage)
+			traced = append(traced, args)
+			assert.Positive(t, d)
+		},
+	}
+	cfg := &config.Config{Command: "run", ProgramArgs: []string{"a"}}
+	_, err := cmd.ExecuteCommand(context.Background(), cfg, "testfile.go")
+	require.NoError(t, err)
+	assert.Equal(t, []Stage{StageCompile, StageRun}, stages)
+	require.Len(t, traced, 2)
+	assert.Equal(t, []string{"go", "build"}, traced[0][:2])
+	assert.Equal(t, "a", traced[1][1])
+}
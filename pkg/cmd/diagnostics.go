@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// Categories of diagnostics, named after the tool that reported them.
+const (
+	CategoryCompile = "compile"
+	CategoryVet     = "vet"
+	CategoryCheck   = "check"
+)
+
+// Formats WriteDiagnostics renders diagnostics in.
+const (
+	DiagnosticsText   = "text"
+	DiagnosticsJSON   = "json"
+	DiagnosticsGitHub = "github"
+)
+
+// DiagnosticsFormats are the formats WriteDiagnostics knows.
+var DiagnosticsFormats = []string{DiagnosticsText, DiagnosticsJSON, DiagnosticsGitHub}
+
+// Diagnostic is an error the go command reported at a position of a file.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+	// Category is the tool that reported the diagnostic.
+	Category string `json:"category"`
+	// SnippetLine is the 1-based line in the snippet, zero if the
+	// diagnostic is outside of it, e.g. in a file of an archive.
+	SnippetLine int `json:"snippet_line,omitempty"`
+}
+
+// diagnosticLine matches "file:line[:column]: message", the file may start
+// with a drive letter.
+var diagnosticLine = regexp.MustCompile(`^(\S.*?):(\d+)(?::(\d+))?: (.*)$`)
+
+// ParseDiagnostics returns the diagnostics in the output of the go command.
+// Indented lines following a diagnostic continue its message. Diagnostics
+// are of the given category unless a "# [package]" line marks them as the
+// vet checks go test runs.
+func ParseDiagnostics(output, category string) []Diagnostic {
+	var diags []Diagnostic
+	current := category
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.HasPrefix(line, "# ") {
+			current = category
+			if strings.HasPrefix(line, "# [") {
+				current = CategoryVet
+			}
+			continue
+		}
+		if m := diagnosticLine.FindStringSubmatch(line); m != nil {
+			//nolint:errcheck // the pattern only matches digits
+			n, _ := strconv.Atoi(m[2])
+			//nolint:errcheck // the column is optional
+			col, _ := strconv.Atoi(m[3])
+			diags = append(diags, Diagnostic{File: m[1], Line: n, Column: col, Message: m[4], Category: current})
+			continue
+		}
+		if len(diags) > 0 && strings.HasPrefix(line, "\t") {
+			last := &diags[len(diags)-1]
+			last.Message += "\n" + strings.TrimSpace(line)
+		}
+	}
+	return diags
+}
+
+// mapDiagnostics points the diagnostics in the snippet at its source as
+// configured instead of the path the go command printed relative to dir,
+// and sets their line in the snippet.
+func mapDiagnostics(diags []Diagnostic, cfg *config.Config, dir string) {
+	source := cfg.Source
+	if source == "" {
+		source = "snippet"
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	for i, d := range diags {
+		file := d.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if file != abs {
+			continue
+		}
+		diags[i].File = source
+		diags[i].SnippetLine = d.Line - max(cfg.Line, 1) + 1
+	}
+}
+
+// String returns the diagnostic the way the go command prints it.
+func (d Diagnostic) String() string {
+	pos := fmt.Sprintf("%s:%d", d.File, d.Line)
+	if d.Column > 0 {
+		pos += ":" + strconv.Itoa(d.Column)
+	}
+	return pos + ": " + d.Message
+}
+
+// GitHub returns the diagnostic as a GitHub Actions error annotation.
+func (d Diagnostic) GitHub() string {
+	props := fmt.Sprintf("file=%s,line=%d", escapeProperty(d.File), d.Line)
+	if d.Column > 0 {
+		props += fmt.Sprintf(",col=%d", d.Column)
+	}
+	props += ",title=" + escapeProperty("go-mask "+d.Category)
+	return fmt.Sprintf("::error %s::%s", props, escapeData(d.Message))
+}
+
+// WriteDiagnostics renders the diagnostics in one of the DiagnosticsFormats.
+func WriteDiagnostics(w io.Writer, diags []Diagnostic, format string) error {
+	switch format {
+	case DiagnosticsJSON:
+		if diags == nil {
+			diags = []Diagnostic{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diags)
+	case DiagnosticsText, DiagnosticsGitHub:
+		for _, d := range diags {
+			line := d.String()
+			if format == DiagnosticsGitHub {
+				line = d.GitHub()
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown diagnostics format %q", format)
+	}
+}
+
+// escapeData escapes the message of a workflow command.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a property value of a workflow command.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
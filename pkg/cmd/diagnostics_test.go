@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		category string
+		expected []Diagnostic
+	}{
+		{
+			name:     "Compiler",
+			output:   "# command-line-arguments\n./snippet:1:1: declared and not used: x\nMaskfile.md:12:13: undefined: y\n",
+			category: CategoryCompile,
+			expected: []Diagnostic{
+				{File: "./snippet", Line: 1, Column: 1, Message: "declared and not used: x", Category: CategoryCompile},
+				{File: "Maskfile.md", Line: 12, Column: 13, Message: "undefined: y", Category: CategoryCompile},
+			},
+		},
+		{
+			name:     "VetOfGoTest",
+			output:   "# command-line-arguments\n# [command-line-arguments]\n./snippet:1:13: fmt.Printf format %d has arg \"x\" of wrong type string\nFAIL\tcommand-line-arguments [build failed]\n",
+			category: CategoryCompile,
+			expected: []Diagnostic{
+				{File: "./snippet", Line: 1, Column: 13, Message: "fmt.Printf format %d has arg \"x\" of wrong type string", Category: CategoryVet},
+			},
+		},
+		{
+			name:     "ContinuationAndNoColumn",
+			output:   "go-mask.go:3: cannot use x\n\thave int\n\twant string\n",
+			category: CategoryVet,
+			expected: []Diagnostic{
+				{File: "go-mask.go", Line: 3, Message: "cannot use x\nhave int\nwant string", Category: CategoryVet},
+			},
+		},
+		{
+			name:     "WindowsPath",
+			output:   "C:\\work\\go-mask.go:4:2: undefined: z\r\n",
+			category: CategoryCompile,
+			expected: []Diagnostic{{File: "C:\\work\\go-mask.go", Line: 4, Column: 2, Message: "undefined: z", Category: CategoryCompile}},
+		},
+		{
+			name:   "NoDiagnostics",
+			output: "panic: boom\n\ngoroutine 1 [running]:\n\t/tmp/go-mask.go:5 +0x1d\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseDiagnostics(tt.output, tt.category))
+		})
+	}
+}
+
+func TestMapDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	diags := []Diagnostic{
+		{File: "../" + filepath.Base(wd) + "/Maskfile.md", Line: 14},
+		{File: filepath.Join(wd, "Maskfile.md"), Line: 12},
+		{File: "./helper.go", Line: 3},
+	}
+	mapDiagnostics(diags, &config.Config{Source: "Maskfile.md", Line: 10}, wd)
+	assert.Equal(t, []Diagnostic{
+		{File: "Maskfile.md", Line: 14, SnippetLine: 5},
+		{File: "Maskfile.md", Line: 12, SnippetLine: 3},
+		{File: "./helper.go", Line: 3},
+	}, diags)
+
+	diags = []Diagnostic{{File: "./snippet", Line: 2}}
+	mapDiagnostics(diags, &config.Config{}, dir)
+	assert.Equal(t, []Diagnostic{{File: "./snippet", Line: 2}}, diags, "the snippet is relative to the current directory")
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	diags := []Diagnostic{
+		{File: "Maskfile.md", Line: 12, Column: 3, Message: "undefined: y\nsee 100%", Category: CategoryCompile},
+		{File: "a,b.go", Line: 4, Message: "unused", Category: CategoryVet},
+	}
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   DiagnosticsText,
+			expected: "Maskfile.md:12:3: undefined: y\nsee 100%\na,b.go:4: unused\n",
+		},
+		{
+			format:   DiagnosticsGitHub,
+			expected: "::error file=Maskfile.md,line=12,col=3,title=go-mask compile::undefined: y%0Asee 100%25\n::error file=a%2Cb.go,line=4,title=go-mask vet::unused\n",
+		},
+		{
+			format:   DiagnosticsJSON,
+			expected: "[\n  {\n    \"file\": \"Maskfile.md\",\n    \"line\": 12,\n    \"column\": 3,\n    \"message\": \"undefined: y\\nsee 100%\",\n    \"category\": \"compile\"\n  },\n  {\n    \"file\": \"a,b.go\",\n    \"line\": 4,\n    \"message\": \"unused\",\n    \"category\": \"vet\"\n  }\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, WriteDiagnostics(&out, diags, tt.format))
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+
+	assert.EqualError(t, WriteDiagnostics(&bytes.Buffer{}, diags, "xml"), `unknown diagnostics format "xml"`)
+}
+
+func TestExecuteCommandDiagnostics(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd := Command{
+		CommandInterface: MockCommand{
+			command: func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+				return exec.CommandContext(ctx, "sh", "-c", "echo '# command-line-arguments' >&2; echo './Maskfile.md:5:13: undefined: y' >&2; exit 1")
+			},
+		},
+		Stderr: &stderr,
+	}
+	res, err := cmd.ExecuteCommand(context.Background(), &config.Config{Command: "run", Source: "Maskfile.md", Line: 4}, "testfile.go")
+	require.Error(t, err)
+	assert.Empty(t, res.Stderr, "the output is streamed only")
+	assert.Contains(t, stderr.String(), "undefined: y")
+	assert.Equal(t, []Diagnostic{
+		{File: "Maskfile.md", Line: 5, Column: 13, Message: "undefined: y", Category: CategoryCompile, SnippetLine: 2},
+	}, res.Diagnostics)
+}
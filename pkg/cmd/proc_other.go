@@ -0,0 +1,19 @@
+//go:build !unix
+
+package cmd
+
+import "os/exec"
+
+func setProcessGroup(_ *exec.Cmd) {}
+
+// interruptProcess kills the command, there is no SIGINT to send.
+func interruptProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+func killProcessGroup(_ *exec.Cmd) error {
+	return nil
+}
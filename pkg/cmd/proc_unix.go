@@ -0,0 +1,40 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so the
+// processes it spawns can be stopped together with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// interruptProcess sends SIGINT to the command, or to its process group if
+// it has one, so the program can run its cleanup like after Ctrl-C.
+func interruptProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(processTarget(cmd), syscall.SIGINT)
+}
+
+// killProcessGroup kills the processes left in the group of the command.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil || processTarget(cmd) > 0 {
+		return nil
+	}
+	return syscall.Kill(processTarget(cmd), syscall.SIGKILL)
+}
+
+// processTarget returns the pid signals are sent to, negative for the
+// process group of the command.
+func processTarget(cmd *exec.Cmd) int {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		return -cmd.Process.Pid
+	}
+	return cmd.Process.Pid
+}
@@ -3,8 +3,11 @@ package code
 import (
 	"bufio"
 	"fmt"
+	"go/format"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/fr12k/go-mask/pkg/config"
@@ -47,29 +50,150 @@ func (c *Reader) GenerateGoCode(cfg *config.Config) (string, error) {
 		fmt.Fprintf(os.Stderr, "Error reading code: %v\n", err)
 		return "", err
 	}
+
+	if cfg.Template {
+		if code, err = renderTemplate(cfg, code); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering template: %v\n", err)
+			return "", err
+		}
+	}
+
+	w, err := newWrapper(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error wrapping code: %v\n", err)
+		return "", err
+	}
+
+	vars, err := declareVars(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error declaring variables: %v\n", err)
+		return "", err
+	}
+
+	imports := slices.Concat(cfg.Imports, snippetImports(code, w))
+	imports = resolveImports(render(cfg, code, nil, w)+vars, imports)
+	src := render(cfg, code, imports, w) + vars
+	if !cfg.Debug {
+		return src, nil
+	}
+	return formatDebug(cfg, code, imports, w, vars, src), nil
+}
+
+// formatDebug formats the code debug mode prints, which is meant to be copied
+// into real files. The code that is built stays as generated because gofmt
+// would move the snippet away from the positions its line directives give it.
+// A snippet that doesn't parse is printed unformatted after reporting the
+// syntax error at its position in the snippet.
+func formatDebug(cfg *config.Config, code string, imports []string, w *wrapper, vars, src string) string {
+	formatted, err := format.Source([]byte(src))
+	if err == nil {
+		return string(formatted)
+	}
+	located := *cfg
+	located.Debug = false
+	if _, lerr := format.Source([]byte(render(&located, code, imports, w) + vars)); lerr != nil {
+		err = lerr
+	}
+	fmt.Fprintf(os.Stderr, "Error formatting Go code, printing it as generated: %v\n", err)
+	return src
+}
+
+func render(cfg *config.Config, code string, imports []string, w *wrapper) string {
 	var out strings.Builder
 	if cfg.Package != "" {
 		out.WriteString(fmt.Sprintf("package %s\n\n", cfg.Package))
 	}
 
-	for _, pkg := range cfg.Imports {
-		out.WriteString(fmt.Sprintf("import %q\n", strings.TrimSpace(pkg)))
+	var chunks []chunk
+	split := false
+	if w != nil {
+		var ok bool
+		chunks, ok = splitSnippet(code)
+		split = ok && slices.ContainsFunc(chunks, func(c chunk) bool { return c.kind != statement })
 	}
-	if len(cfg.Imports) > 0 {
-		out.WriteString("\n")
+
+	specs := make([]string, 0, len(imports))
+	for _, pkg := range imports {
+		specs = append(specs, strconv.Quote(strings.TrimSpace(pkg)))
 	}
+	// Without line directives nothing points at the named imports of the
+	// snippet, so they join the others.
+	if split && cfg.Debug {
+		for _, c := range chunks {
+			if c.kind != importDecl {
+				continue
+			}
+			if _, named, ok := splitImports(c.code); ok {
+				specs = append(specs, named...)
+			}
+		}
+	}
+	out.WriteString(importBlock(specs))
 
-	if cfg.MainFunc {
-		out.WriteString("func main() {\n")
+	if w == nil {
+		out.WriteString(lineDirective(cfg, 1))
 		out.WriteString(code)
 		out.WriteString("\n")
-		out.WriteString("}\n")
-	} else {
+		return out.String()
+	}
+
+	if !split {
+		out.WriteString(w.open)
+		out.WriteString(lineDirective(cfg, 1))
 		out.WriteString(code)
 		out.WriteString("\n")
+		out.WriteString(w.close)
+		return out.String()
+	}
+
+	// Imports have to precede every other declaration of the file. Plain
+	// imports are part of the resolved ones, so only named ones are left.
+	for _, k := range []kind{importDecl, decl} {
+		for _, c := range chunks {
+			if c.kind != k {
+				continue
+			}
+			if k == importDecl {
+				if _, named, ok := splitImports(c.code); ok {
+					if len(named) == 0 || cfg.Debug {
+						continue
+					}
+					c.code = "import " + strings.Join(named, "\nimport ")
+				}
+			}
+			out.WriteString(lineDirective(cfg, c.line))
+			out.WriteString(c.code)
+			out.WriteString("\n\n")
+		}
+	}
+	out.WriteString(w.open)
+	first := true
+	for _, c := range chunks {
+		if c.kind != statement {
+			continue
+		}
+		// gofmt keeps blank lines at the start of a block, debug output
+		// drops the ones that separated the statements from declarations.
+		if first && cfg.Debug {
+			c.code = strings.TrimLeft(c.code, "\n")
+		}
+		first = false
+		out.WriteString(lineDirective(cfg, c.line))
+		out.WriteString(c.code)
+		out.WriteString("\n")
 	}
+	out.WriteString(w.close)
+
+	return out.String()
+}
 
-	return out.String(), nil
+// lineDirective returns the //line directive for the given snippet line.
+// Debug output is meant to be read and copied, so it stays free of them.
+func lineDirective(cfg *config.Config, line int) string {
+	if cfg.Debug {
+		return ""
+	}
+	return cfg.LineDirective(line)
 }
 
 func readAllCode(code io.Reader) (string, error) {
@@ -1,6 +1,7 @@
 package code
 
 import (
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -55,6 +56,7 @@ func TestReadCode_ReadFromStdinWithError(t *testing.T) {
 }
 
 func TestGenerateGoCode(t *testing.T) {
+	directive := (&config.Config{}).LineDirective(1)
 	tests := []struct {
 		name     string
 		cfg      *config.Config
@@ -71,10 +73,12 @@ func TestGenerateGoCode(t *testing.T) {
 			code: `fmt.Println("Hello, World!")`,
 			expected: `package mypackage
 
-import "fmt"
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
-fmt.Println("Hello, World!")
+` + directive + `fmt.Println("Hello, World!")
 `,
 		},
 		{
@@ -90,7 +94,7 @@ fmt.Println("Hello, World!")
 import "fmt"
 
 func main() {
-fmt.Println("Hello, World!")
+` + directive + `fmt.Println("Hello, World!")
 }
 `,
 		},
@@ -102,7 +106,7 @@ fmt.Println("Hello, World!")
 				MainFunc: false,
 			},
 			code: `fmt.Println("Hello, World!")`,
-			expected: `fmt.Println("Hello, World!")
+			expected: directive + `fmt.Println("Hello, World!")
 `,
 		},
 	}
@@ -132,3 +136,84 @@ func TestGenerateGoCodeErrorReadingCode(t *testing.T) {
 	assert.Error(t, err, "An error should be returned when reading code")
 	assert.Empty(t, output, "Generated code should be empty when an error occurs")
 }
+
+func TestGenerateGoCodeLineDirective(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected string
+	}{
+		{
+			name:     "MaskfileOrigin",
+			cfg:      &config.Config{Source: "/work/Maskfile.md", Line: 12},
+			expected: "//line /work/Maskfile.md:12:1\nfmt.Println(\"Hello, World!\")\n",
+		},
+		{
+			name:     "DebugOmitsDirective",
+			cfg:      &config.Config{Debug: true},
+			expected: "fmt.Println(\"Hello, World!\")\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(`fmt.Println("Hello, World!")`))
+			output, err := reader.GenerateGoCode(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, output)
+		})
+	}
+}
+
+func TestGenerateGoCodeDebugFormat(t *testing.T) {
+	code := "import y \"gopkg.in/yaml.v3\"\n\nfunc  parse(s string) map[string]any {\n  m := map[string]any{}\n  _ = y.Unmarshal([]byte(s), &m)\n  return m\n}\n\nfor k,v := range parse(\"a: 1\") {\n    fmt.Println(k,v)\n}\n"
+	output, err := NewReader(strings.NewReader(code)).GenerateGoCode(&config.Config{
+		Package:  "main",
+		MainFunc: true,
+		Debug:    true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `package main
+
+import (
+	"fmt"
+
+	y "gopkg.in/yaml.v3"
+)
+
+func parse(s string) map[string]any {
+	m := map[string]any{}
+	_ = y.Unmarshal([]byte(s), &m)
+	return m
+}
+
+func main() {
+	for k, v := range parse("a: 1") {
+		fmt.Println(k, v)
+	}
+}
+`, output)
+}
+
+func TestGenerateGoCodeDebugSyntaxError(t *testing.T) {
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = w
+
+	output, err := NewReader(strings.NewReader("x := 1\nfmt.Println(x +)\n")).GenerateGoCode(&config.Config{
+		Package:  "main",
+		MainFunc: true,
+		Debug:    true,
+		Source:   "/work/Maskfile.md",
+		Line:     10,
+	})
+	require.NoError(t, err)
+	w.Close()
+	msg, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, "package main\n\nfunc main() {\nx := 1\nfmt.Println(x +)\n\n}\n", output)
+	assert.Contains(t, string(msg), "/work/Maskfile.md:11:16: expected operand")
+}
@@ -0,0 +1,39 @@
+package code
+
+import "strings"
+
+// directivePrefix starts a comment that configures the snippet.
+const directivePrefix = "//go-mask:"
+
+// Directives returns the //go-mask: comments at the top of the code, before
+// the first line that is neither blank nor a comment, as attributes:
+// "//go-mask:timeout 5s" becomes "timeout=5s" and "//go-mask:mainfunc"
+// becomes "mainfunc".
+func (c *Reader) Directives() ([]string, error) {
+	code, err := c.ReadCode()
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []string
+	for line := range strings.Lines(code) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		directive, ok := strings.CutPrefix(line, directivePrefix)
+		if !ok {
+			continue
+		}
+		name, value, _ := strings.Cut(directive, " ")
+		if value = strings.TrimSpace(value); value != "" {
+			attrs = append(attrs, name+"="+value)
+		} else {
+			attrs = append(attrs, name)
+		}
+	}
+	return attrs, nil
+}
@@ -0,0 +1,39 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected []string
+	}{
+		{
+			name:     "Directives",
+			code:     "//go-mask:mainfunc\n// a comment\n\n//go-mask:import encoding/json\n//go-mask:env KEY=a b\n  //go-mask:timeout  5s \nfmt.Println()\n",
+			expected: []string{"mainfunc", "import=encoding/json", "env=KEY=a b", "timeout=5s"},
+		},
+		{
+			name: "OnlyAtTheTop",
+			code: "fmt.Println()\n//go-mask:mainfunc\n",
+		},
+		{
+			name: "NoDirectives",
+			code: "// go-mask:mainfunc isn't one\nfmt.Println()\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs, err := NewReader(strings.NewReader(tt.code)).Directives()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, attrs)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package code
+
+import (
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// The headers and footer turn declarations and statements into a file
+// gofmt accepts.
+const (
+	declHeader = "package p\n\n"
+	stmtHeader = declHeader + "func _() {\n"
+	stmtFooter = "\n}\n"
+)
+
+// FormatSnippet formats the snippet like gofmt. Complete files are formatted
+// as they are, snippets chunk by chunk: declarations at package level and
+// statements in a function body. Syntax errors point into the source of the
+// snippet.
+func FormatSnippet(cfg *config.Config, code string) (string, error) {
+	if strings.TrimSpace(code) == "" {
+		return code, nil
+	}
+	if HasPackageClause(code) {
+		src, err := format.Source([]byte(cfg.LineDirective(1) + code))
+		if err != nil {
+			return "", err
+		}
+		return dropDirectives(string(src)), nil
+	}
+
+	chunks, ok := splitSnippet(code)
+	if !ok {
+		chunks = []chunk{{kind: statement, line: 1, code: code}}
+	}
+	parts := make([]string, 0, len(chunks))
+	for _, c := range chunks {
+		part, err := formatChunk(cfg, c)
+		if err != nil {
+			return "", err
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n") + "\n", nil
+}
+
+// formatChunk formats the chunk in the file it would be generated into and
+// returns it without the surrounding file.
+func formatChunk(cfg *config.Config, c chunk) (string, error) {
+	header, footer := declHeader, ""
+	if c.kind == statement {
+		header, footer = stmtHeader, stmtFooter
+	}
+	src, err := format.Source([]byte(header + cfg.LineDirective(c.line) + c.code + footer))
+	if err != nil {
+		return "", err
+	}
+
+	body := dropDirectives(string(src))
+	body = strings.TrimPrefix(body, header)
+	if c.kind == statement {
+		body = unindent(strings.TrimSuffix(body, "}\n"))
+	}
+	return strings.Trim(body, "\n"), nil
+}
+
+// ExtractSnippet returns the snippet with its declarations and statements
+// replaced by their counterparts in the generated file, e.g. after go fix
+// rewrote it. The line directives of the generated file tell which chunk of
+// the snippet they belong to. Imports are kept as they are.
+func ExtractSnippet(cfg *config.Config, code, generated string) (string, error) {
+	w, err := newWrapper(cfg)
+	if err != nil {
+		return "", err
+	}
+	vars, err := declareVars(cfg)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Template {
+		return "", fmt.Errorf("templates can't be mapped back to the snippet")
+	}
+
+	chunks, ok := splitSnippet(code)
+	if !ok || w == nil {
+		chunks = []chunk{{kind: statement, line: 1, code: strings.TrimSuffix(code, "\n")}}
+	}
+
+	segments, err := segments(cfg, generated, w, vars)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(chunks))
+	for _, c := range chunks {
+		if seg, ok := segments[c.line]; ok && c.kind != importDecl {
+			// go fix indents the statements it rewrote like in any function.
+			if indented(seg) && !indented(c.code) {
+				seg = unindent(seg)
+			}
+			lead := len(c.code) - len(strings.TrimLeft(c.code, "\n"))
+			trail := len(c.code) - len(strings.TrimRight(c.code, "\n"))
+			c.code = c.code[:lead] + seg + c.code[len(c.code)-trail:]
+		}
+		parts = append(parts, c.code)
+	}
+	out := strings.Join(parts, "\n")
+	if strings.HasSuffix(code, "\n") {
+		out += "\n"
+	}
+	return out, nil
+}
+
+// segments returns the code following every line directive of the
+// generated file by the snippet line the directive names.
+func segments(cfg *config.Config, generated string, w *wrapper, vars string) (map[int]string, error) {
+	tail := vars
+	if w != nil {
+		tail = w.close + vars
+	}
+	body, ok := strings.CutSuffix(generated, tail)
+	if !ok {
+		return nil, fmt.Errorf("the end of the generated file changed, it can't be mapped back to the snippet")
+	}
+
+	// The directives only differ in their line, cut off with the column.
+	prefix := strings.TrimSuffix(cfg.LineDirective(1), ":1\n")
+	prefix = prefix[:strings.LastIndex(prefix, ":")+1]
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	segments := map[int]string{}
+	var current []string
+	line := 0
+	flush := func() {
+		if line == 0 {
+			return
+		}
+		text := strings.Join(current, "\n")
+		if w != nil {
+			text = strings.TrimSuffix(text, strings.TrimSuffix(w.open, "\n"))
+		}
+		segments[line] = strings.Trim(text, "\n")
+	}
+	for _, l := range lines {
+		rest, ok := strings.CutPrefix(l, prefix)
+		if !ok {
+			current = append(current, l)
+			continue
+		}
+		flush()
+		n, err := strconv.Atoi(strings.TrimSuffix(rest, ":1"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line directive %q", l)
+		}
+		line, current = n-max(cfg.Line, 1)+1, nil
+	}
+	flush()
+	return segments, nil
+}
+
+// dropDirectives removes the line directives added for the error positions.
+func dropDirectives(src string) string {
+	lines := strings.SplitAfter(src, "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(l), "//line ") {
+			kept = append(kept, l)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// indented reports whether every line that isn't blank starts with a tab,
+// which is how gofmt indents a function body.
+func indented(src string) bool {
+	found := false
+	for _, l := range strings.Split(src, "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if !strings.HasPrefix(l, "\t") {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// unindent removes one leading tab from every line, except for the lines
+// continuing a raw string literal whose content must not change.
+func unindent(src string) string {
+	raw := rawStringLines(src)
+	lines := strings.Split(src, "\n")
+	for i, l := range lines {
+		if !raw[i+1] {
+			lines[i] = strings.TrimPrefix(l, "\t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rawStringLines returns the 1-based lines that continue a raw string
+// literal started on a previous line.
+func rawStringLines(src string) map[int]bool {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+
+	lines := map[int]bool{}
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return lines
+		}
+		if tok != token.STRING || !strings.HasPrefix(lit, "`") {
+			continue
+		}
+		start := file.Line(pos)
+		end := file.Line(pos + token.Pos(len(lit)) - 1)
+		for l := start + 1; l <= end; l++ {
+			lines[l] = true
+		}
+	}
+}
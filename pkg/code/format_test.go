@@ -0,0 +1,118 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSnippet(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "Statements",
+			code:     "x:=1\nif x>0 {\nfmt.Println( x )\n}\n",
+			expected: "x := 1\nif x > 0 {\n\tfmt.Println(x)\n}\n",
+		},
+		{
+			name:     "DeclarationsAndStatements",
+			code:     "import \"strings\"\nfunc shout(s string) string {\nreturn strings.ToUpper(s)\n}\nfmt.Println(shout( \"a\" ))\n",
+			expected: "import \"strings\"\n\nfunc shout(s string) string {\n\treturn strings.ToUpper(s)\n}\n\nfmt.Println(shout(\"a\"))\n",
+		},
+		{
+			name:     "RawString",
+			code:     "if true {\ns := `a\n\tb`\n_ = s\n}\n",
+			expected: "if true {\n\ts := `a\n\tb`\n\t_ = s\n}\n",
+		},
+		{
+			name:     "File",
+			code:     "package main\nfunc main() {\nprintln( 1 )\n}\n",
+			expected: "package main\n\nfunc main() {\n\tprintln(1)\n}\n",
+		},
+		{
+			name:     "Empty",
+			code:     "\n",
+			expected: "\n",
+		},
+		{
+			name:          "SyntaxError",
+			code:          "x := 1\ny := \n",
+			expectedError: "Maskfile.md:13:1: expected operand, found '}'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Source: "/work/Maskfile.md", Line: 11}
+			got, err := FormatSnippet(cfg, tt.code)
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.True(t, strings.HasSuffix(err.Error(), tt.expectedError), err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestExtractSnippet(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		code     string
+		fix      func(string) string
+		expected string
+	}{
+		{
+			name: "DeclarationsAndStatements",
+			cfg:  config.Config{Package: "main", MainFunc: true, Line: 5},
+			code: "import \"fmt\"\n\nfunc show(v interface{}) { fmt.Println(v) }\n\nfor i := 0; i < 3; i++ {\nshow(i)\n}\n",
+			fix: func(s string) string {
+				s = strings.Replace(s, "interface{}", "any", 1)
+				return strings.Replace(s, "for i := 0; i < 3; i++ {\nshow(i)\n}", "\tfor i := range 3 {\n\t\tshow(i)\n\t}", 1)
+			},
+			expected: "import \"fmt\"\n\nfunc show(v any) { fmt.Println(v) }\n\nfor i := range 3 {\n\tshow(i)\n}\n",
+		},
+		{
+			name:     "WithoutWrapper",
+			cfg:      config.Config{Package: "main"},
+			code:     "func f(v interface{}) {}\n",
+			fix:      func(s string) string { return strings.Replace(s, "interface{}", "any", 1) },
+			expected: "func f(v any) {}\n",
+		},
+		{
+			name:     "Unchanged",
+			cfg:      config.Config{Package: "main", Wrap: "test", Vars: []string{"n:int=1"}},
+			code:     "t.Log(n)",
+			fix:      func(s string) string { return s },
+			expected: "t.Log(n)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generated, err := NewReader(strings.NewReader(tt.code)).GenerateGoCode(&tt.cfg)
+			require.NoError(t, err)
+			got, err := ExtractSnippet(&tt.cfg, tt.code, tt.fix(generated))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestExtractSnippetError(t *testing.T) {
+	cfg := &config.Config{Package: "main", MainFunc: true}
+	_, err := ExtractSnippet(cfg, "x := 1", "package main\n")
+	assert.EqualError(t, err, "the end of the generated file changed, it can't be mapped back to the snippet")
+
+	_, err = ExtractSnippet(&config.Config{Template: true}, "x := 1", "")
+	assert.EqualError(t, err, "templates can't be mapped back to the snippet")
+}
@@ -0,0 +1,203 @@
+package code
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// fakeImporter satisfies every import with an empty package so the type
+// checker can tell package names apart from undeclared identifiers without
+// loading any real export data.
+type fakeImporter struct{}
+
+func (fakeImporter) Import(importPath string) (*types.Package, error) {
+	pkg := types.NewPackage(importPath, importName(importPath))
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// resolveImports returns the imports the generated file needs. The src has to
+// be the generated file without any of the configured imports. Packages the
+// snippet references without importing them are added from the standard
+// library, configured imports the snippet never uses are dropped. If src can't
+// be parsed the configured imports are returned unchanged.
+func resolveImports(src string, imports []string) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return imports
+	}
+
+	info := &types.Info{Uses: map[*ast.Ident]types.Object{}}
+	conf := types.Config{Importer: fakeImporter{}, Error: func(error) {}}
+	//nolint:errcheck // the snippet is incomplete by design, only info is needed
+	conf.Check("", fset, []*ast.File{f}, info)
+
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && info.Uses[id] == nil {
+			used[id.Name] = true
+		}
+		return true
+	})
+
+	resolved := []string{}
+	seen := map[string]bool{}
+	for _, pkg := range imports {
+		pkg = strings.TrimSpace(pkg)
+		name := importName(pkg)
+		if !used[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+		resolved = append(resolved, pkg)
+	}
+
+	missing := []string{}
+	for name := range used {
+		if pkg, ok := stdlib[name]; ok && !seen[name] {
+			missing = append(missing, pkg)
+		}
+	}
+	slices.Sort(missing)
+	return append(resolved, missing...)
+}
+
+// splitImports parses an import declaration of the snippet into the paths
+// of its plain imports and the specs of the remaining named, dot or blank
+// imports, e.g. s "strings". It reports false if the declaration doesn't
+// parse.
+func splitImports(decl string) ([]string, []string, bool) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+decl, parser.ImportsOnly)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	var paths, named []string
+	for _, spec := range f.Imports {
+		if spec.Name == nil {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, nil, false
+			}
+			paths = append(paths, path)
+			continue
+		}
+		named = append(named, spec.Name.Name+" "+spec.Path.Value)
+	}
+	return paths, named, true
+}
+
+// importBlock renders the import specs as a single declaration with the
+// standard library in the first group and every other package in a second
+// one, sorted by path like goimports does.
+func importBlock(specs []string) string {
+	if len(specs) == 0 {
+		return ""
+	}
+	if len(specs) == 1 {
+		return "import " + specs[0] + "\n\n"
+	}
+
+	var std, other []string
+	for _, spec := range specs {
+		if isStdlib(specPath(spec)) {
+			std = append(std, spec)
+		} else {
+			other = append(other, spec)
+		}
+	}
+	byPath := func(a, b string) int { return strings.Compare(specPath(a), specPath(b)) }
+	slices.SortStableFunc(std, byPath)
+	slices.SortStableFunc(other, byPath)
+
+	var out strings.Builder
+	out.WriteString("import (\n")
+	for i, group := range [][]string{std, other} {
+		if i > 0 && len(std) > 0 && len(other) > 0 {
+			out.WriteString("\n")
+		}
+		for _, spec := range group {
+			out.WriteString("\t" + spec + "\n")
+		}
+	}
+	out.WriteString(")\n\n")
+	return out.String()
+}
+
+// specPath returns the import path of a spec like s "strings".
+func specPath(spec string) string {
+	quoted := spec[strings.LastIndex(spec, " ")+1:]
+	if path, err := strconv.Unquote(quoted); err == nil {
+		return path
+	}
+	return quoted
+}
+
+// isStdlib reports whether the import path belongs to the standard library,
+// whose paths have no dot in their first element.
+func isStdlib(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// HasPackageClause reports whether src is a complete Go file starting with
+// a package clause rather than a snippet.
+func HasPackageClause(src string) bool {
+	_, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	return err == nil
+}
+
+// snippetImports returns the plain imports of the snippet, which are merged
+// with the configured ones.
+func snippetImports(code string, w *wrapper) []string {
+	if w == nil {
+		return nil
+	}
+	chunks, ok := splitSnippet(code)
+	if !ok {
+		return nil
+	}
+	var imports []string
+	for _, c := range chunks {
+		if c.kind != importDecl {
+			continue
+		}
+		if paths, _, ok := splitImports(c.code); ok {
+			imports = append(imports, paths...)
+		}
+	}
+	return imports
+}
+
+// importName guesses the package name of an import path the same way
+// goimports does: the last path element without a major version suffix,
+// a "go-" prefix or anything after the first non identifier character.
+func importName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
@@ -0,0 +1,160 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveImports(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		imports  []string
+		expected []string
+	}{
+		{
+			name:     "AddMissingStdlib",
+			src:      "package main\nfunc main() {\nb, _ := json.Marshal(strings.Split(\"a,b\", \",\"))\nfmt.Println(string(b))\n}\n",
+			imports:  []string{},
+			expected: []string{"encoding/json", "fmt", "strings"},
+		},
+		{
+			name:     "DropUnused",
+			src:      "package main\nfunc main() {\nfmt.Println()\n}\n",
+			imports:  []string{"fmt", "os"},
+			expected: []string{"fmt"},
+		},
+		{
+			name:     "KeepConfiguredPath",
+			src:      "package main\nfunc main() {\n_ = rand.N(10)\n_ = yaml.Marshal\n}\n",
+			imports:  []string{"math/rand/v2", "gopkg.in/yaml.v3"},
+			expected: []string{"math/rand/v2", "gopkg.in/yaml.v3"},
+		},
+		{
+			name:     "IgnoreLocalIdentifiers",
+			src:      "package main\nfunc main() {\nstrings := []string{}\n_ = len(strings)\nvar t struct{ Run int }\n_ = t.Run\n}\n",
+			imports:  []string{},
+			expected: []string{},
+		},
+		{
+			name:     "SnippetImportsWin",
+			src:      "package main\nimport \"fmt\"\nfunc main() {\nfmt.Println(os.Args)\n}\n",
+			imports:  []string{"fmt"},
+			expected: []string{"os"},
+		},
+		{
+			name:     "UnparsableKeepsImports",
+			src:      "fmt.Println(\"Hello\")\n",
+			imports:  []string{"fmt", "os"},
+			expected: []string{"fmt", "os"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, resolveImports(tt.src, tt.imports))
+		})
+	}
+}
+
+func TestImportName(t *testing.T) {
+	tests := map[string]string{
+		"fmt":                        "fmt",
+		"encoding/json":              "json",
+		"math/rand/v2":               "rand",
+		"gopkg.in/yaml.v3":           "yaml",
+		"github.com/fr12k/go-file":   "file",
+		"github.com/foo/bar-baz/v10": "bar",
+	}
+	for importPath, name := range tests {
+		t.Run(importPath, func(t *testing.T) {
+			assert.Equal(t, name, importName(importPath))
+		})
+	}
+}
+
+func TestGenerateGoCodeAutoImports(t *testing.T) {
+	reader := NewReader(strings.NewReader(`fmt.Println(strings.ToUpper("hello"))`))
+	output, err := reader.GenerateGoCode(&config.Config{
+		Package:  "main",
+		Imports:  []string{"os"},
+		MainFunc: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+`+(&config.Config{}).LineDirective(1)+`fmt.Println(strings.ToUpper("hello"))
+}
+`, output)
+}
+
+func TestSplitImports(t *testing.T) {
+	paths, named, ok := splitImports("import (\n\t\"fmt\"\n\tstr \"strings\"\n\t_ \"embed\"\n)")
+	require.True(t, ok)
+	assert.Equal(t, []string{"fmt"}, paths)
+	assert.Equal(t, []string{"str \"strings\"", "_ \"embed\""}, named)
+
+	_, _, ok = splitImports("import (")
+	assert.False(t, ok)
+}
+
+func TestHasPackageClause(t *testing.T) {
+	assert.True(t, HasPackageClause("// Package main is a demo.\npackage main\n\nfunc f() {}\n"))
+	assert.False(t, HasPackageClause("func f() {}\n"))
+	assert.False(t, HasPackageClause("fmt.Println(\"package main\")\n"))
+}
+
+func TestGenerateGoCodeMergeImports(t *testing.T) {
+	reader := NewReader(strings.NewReader("import \"strings\"\nimport s \"strings\"\nfmt.Println(strings.ToUpper(\"a\"), s.ToLower(\"B\"))\nimport \"strings\"\n"))
+	output, err := reader.GenerateGoCode(&config.Config{
+		Package:  "main",
+		Imports:  []string{"fmt", "strings"},
+		MainFunc: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(output, "\t\"strings\"\n"), output)
+	assert.Contains(t, output, "import (\n\t\"fmt\"\n\t\"strings\"\n)\n")
+	assert.Contains(t, output, "import s \"strings\"\n")
+}
+
+func TestImportBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		specs    []string
+		expected string
+	}{
+		{name: "None"},
+		{name: "Single", specs: []string{`"fmt"`}, expected: "import \"fmt\"\n\n"},
+		{
+			name:     "Stdlib",
+			specs:    []string{`"strings"`, `"fmt"`},
+			expected: "import (\n\t\"fmt\"\n\t\"strings\"\n)\n\n",
+		},
+		{
+			name:     "Grouped",
+			specs:    []string{`"github.com/fr12k/go-file"`, `"os"`, `yaml "gopkg.in/yaml.v3"`, `_ "embed"`},
+			expected: "import (\n\t_ \"embed\"\n\t\"os\"\n\n\t\"github.com/fr12k/go-file\"\n\tyaml \"gopkg.in/yaml.v3\"\n)\n\n",
+		},
+		{
+			name:     "ThirdPartyOnly",
+			specs:    []string{`"golang.org/x/sync/errgroup"`, `"example.com/b"`},
+			expected: "import (\n\t\"example.com/b\"\n\t\"golang.org/x/sync/errgroup\"\n)\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, importBlock(tt.specs))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package code
+
+import (
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+const (
+	statement kind = iota
+	importDecl
+	decl
+)
+
+type (
+	kind int
+
+	// chunk is a run of whole snippet lines that either holds imports,
+	// other top-level declarations or statements meant for the body of main.
+	chunk struct {
+		kind kind
+		// line is the 1-based line of the chunk within the snippet.
+		line int
+		code string
+	}
+
+	item struct {
+		kind  kind
+		start int
+		end   int
+	}
+
+	scanned struct {
+		tok token.Token
+		pos token.Pos
+		lit string
+	}
+)
+
+// splitSnippet splits the snippet into declarations that have to live at
+// package level (func, type and import, plus var and const before the first
+// statement) and the remaining statements. It reports false if the snippet
+// can't be split along line boundaries, e.g. because it doesn't scan.
+func splitSnippet(code string) ([]chunk, bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(code))
+
+	failed := false
+	var s scanner.Scanner
+	s.Init(file, []byte(code), func(token.Position, string) { failed = true }, 0)
+
+	var toks []scanned
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		toks = append(toks, scanned{tok, pos, lit})
+	}
+	if failed {
+		return nil, false
+	}
+
+	endLine := func(t scanned) int {
+		if t.tok == token.SEMICOLON || t.lit == "" {
+			return file.Line(t.pos)
+		}
+		return file.Line(t.pos + token.Pos(len(t.lit)) - 1)
+	}
+
+	var items []item
+	depth, statements := 0, false
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.tok == token.SEMICOLON {
+			continue
+		}
+		it := item{kind: kindOf(toks, i, statements), start: file.Line(t.pos)}
+		// The semicolons in the header of a for, if or switch statement
+		// don't end it, the header runs until the opening brace.
+		header := false
+		for ; i < len(toks); i++ {
+			switch toks[i].tok {
+			case token.FOR, token.IF, token.SWITCH:
+				header = header || depth == 0
+			case token.LBRACE:
+				header = header && depth != 0
+				depth++
+			case token.LPAREN, token.LBRACK:
+				depth++
+			case token.RPAREN, token.RBRACE, token.RBRACK:
+				depth--
+			}
+			if depth == 0 && !header && toks[i].tok == token.SEMICOLON {
+				break
+			}
+			it.end = endLine(toks[i])
+		}
+		if n := len(items); n > 0 && items[n-1].end >= it.start {
+			return nil, false
+		}
+		statements = statements || it.kind == statement
+		items = append(items, it)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(code, "\n"), "\n")
+	var chunks []chunk
+	from := 1
+	for i, it := range items {
+		to := it.end
+		if i == len(items)-1 {
+			to = len(lines)
+		}
+		text := strings.Join(lines[from-1:to], "\n")
+		if n := len(chunks); n > 0 && chunks[n-1].kind == it.kind {
+			chunks[n-1].code += "\n" + text
+		} else {
+			chunks = append(chunks, chunk{kind: it.kind, line: from, code: text})
+		}
+		from = to + 1
+	}
+	return chunks, true
+}
+
+// kindOf tells whether the statement starting at toks[i] is a top-level
+// declaration. A func is a declaration unless it's a function literal, var
+// and const are only hoisted as long as no statement came before them
+// because they might refer to local variables.
+func kindOf(toks []scanned, i int, statements bool) kind {
+	switch toks[i].tok {
+	case token.IMPORT:
+		return importDecl
+	case token.TYPE:
+		return decl
+	case token.VAR, token.CONST:
+		if statements {
+			return statement
+		}
+		return decl
+	case token.FUNC:
+		if i+1 >= len(toks) {
+			return statement
+		}
+		if toks[i+1].tok == token.IDENT {
+			return decl
+		}
+		if toks[i+1].tok != token.LPAREN {
+			return statement
+		}
+		// func (r T) Name( is a method, func() T { a function literal.
+		depth := 0
+		for j := i + 1; j < len(toks); j++ {
+			switch toks[j].tok {
+			case token.LPAREN:
+				depth++
+			case token.RPAREN:
+				depth--
+			}
+			if depth == 0 {
+				if j+2 < len(toks) && toks[j+1].tok == token.IDENT && toks[j+2].tok == token.LPAREN {
+					return decl
+				}
+				return statement
+			}
+		}
+	}
+	return statement
+}
@@ -0,0 +1,107 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSnippet(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected []chunk
+		ok       bool
+	}{
+		{
+			name:     "OnlyStatements",
+			code:     "x := 1\nfmt.Println(x)\n",
+			expected: []chunk{{kind: statement, line: 1, code: "x := 1\nfmt.Println(x)"}},
+			ok:       true,
+		},
+		{
+			name: "HoistDeclarations",
+			code: "import \"strings\"\n\n// Shout is loud.\nfunc Shout(s string) string {\n\treturn strings.ToUpper(s)\n}\n\nfmt.Println(Shout(greeting))\n\ntype T struct{}\n",
+			expected: []chunk{
+				{kind: importDecl, line: 1, code: "import \"strings\""},
+				{kind: decl, line: 2, code: "\n// Shout is loud.\nfunc Shout(s string) string {\n\treturn strings.ToUpper(s)\n}"},
+				{kind: statement, line: 7, code: "\nfmt.Println(Shout(greeting))"},
+				{kind: decl, line: 9, code: "\ntype T struct{}"},
+			},
+			ok: true,
+		},
+		{
+			name: "VarAndConstBeforeStatements",
+			code: "const (\n\ta = 1\n)\nvar b = a\nc := b\nvar d = c\n",
+			expected: []chunk{
+				{kind: decl, line: 1, code: "const (\n\ta = 1\n)\nvar b = a"},
+				{kind: statement, line: 5, code: "c := b\nvar d = c"},
+			},
+			ok: true,
+		},
+		{
+			name: "MethodsAndFunctionLiterals",
+			code: "func (t T) String() string { return \"t\" }\nfunc() error { return nil }()\nfunc() { }()\n",
+			expected: []chunk{
+				{kind: decl, line: 1, code: "func (t T) String() string { return \"t\" }"},
+				{kind: statement, line: 2, code: "func() error { return nil }()\nfunc() { }()"},
+			},
+			ok: true,
+		},
+		{
+			name: "StatementHeaders",
+			code: "func f() {}\nfor i := 0; i < 3; i++ {\n\tif x := i; x > 1 {\n\t} else if y := x; y > 0 {\n\t}\n}\nswitch x := 1; x {\n}\n",
+			expected: []chunk{
+				{kind: decl, line: 1, code: "func f() {}"},
+				{kind: statement, line: 2, code: "for i := 0; i < 3; i++ {\n\tif x := i; x > 1 {\n\t} else if y := x; y > 0 {\n\t}\n}\nswitch x := 1; x {\n}"},
+			},
+			ok: true,
+		},
+		{
+			name: "SharedLine",
+			code: "x := 1; type T int\n",
+			ok:   false,
+		},
+		{
+			name: "ScanError",
+			code: "x := \"unterminated\n",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, ok := splitSnippet(tt.code)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, chunks)
+		})
+	}
+}
+
+func TestGenerateGoCodeHoistDeclarations(t *testing.T) {
+	code := "type greeter struct{ name string }\n\nfunc (g greeter) greet() string {\n\treturn \"Hello, \" + g.name\n}\n\nfmt.Println(greeter{\"World\"}.greet())"
+	reader := NewReader(strings.NewReader(code))
+	output, err := reader.GenerateGoCode(&config.Config{
+		Package:  "main",
+		MainFunc: true,
+		Debug:    true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `package main
+
+import "fmt"
+
+type greeter struct{ name string }
+
+func (g greeter) greet() string {
+	return "Hello, " + g.name
+}
+
+func main() {
+	fmt.Println(greeter{"World"}.greet())
+}
+`, output)
+}
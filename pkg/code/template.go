@@ -0,0 +1,65 @@
+package code
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// templateData is what the template of a snippet has access to.
+type templateData struct {
+	Config *config.Config
+	// Env are the environment variables of go-mask.
+	Env map[string]string
+	// Vars are the variables of the config with their typed values.
+	Vars map[string]any
+}
+
+var templateFuncs = template.FuncMap{
+	"quote": strconv.Quote,
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+	"readFile": func(path string) (string, error) {
+		b, err := os.ReadFile(path)
+		return string(b), err
+	},
+}
+
+// renderTemplate executes the code as text/template. Missing keys are an
+// error instead of rendering as "<no value>".
+func renderTemplate(cfg *config.Config, code string) (string, error) {
+	name := cfg.Source
+	if name == "" {
+		name = "snippet"
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(code)
+	if err != nil {
+		return "", err
+	}
+
+	environ := os.Environ()
+	data := templateData{Config: cfg, Env: map[string]string{}, Vars: map[string]any{}}
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		data.Env[key] = value
+	}
+	vars, err := variables(cfg, environ)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range vars {
+		if data.Vars[v.Name], err = typedValue(v); err != nil {
+			return "", err
+		}
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
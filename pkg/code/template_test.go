@@ -0,0 +1,85 @@
+package code
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := filepath.Join(t.TempDir(), "data.txt")
+	require.NoError(t, os.WriteFile(data, []byte("a \"quoted\" line\n"), 0o600))
+	t.Setenv("GO_MASK_TEMPLATE", "from env")
+
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		code          string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "Config",
+			cfg:      config.Config{Command: "test", Imports: []string{"fmt", "os"}},
+			code:     `{{.Config.Command}} {{join "," .Config.Imports}}`,
+			expected: "test fmt,os",
+		},
+		{
+			name:     "EnvAndQuote",
+			code:     `fmt.Println({{quote .Env.GO_MASK_TEMPLATE}})`,
+			expected: `fmt.Println("from env")`,
+		},
+		{
+			name:     "TypedVars",
+			cfg:      config.Config{Vars: []string{"n:int=2", "debug:bool=true"}},
+			code:     `{{range .Vars.n}}x{{end}}{{if .Vars.debug}} debug{{end}}`,
+			expected: "xx debug",
+		},
+		{
+			name:     "ReadFile",
+			code:     `{{quote (readFile "` + data + `")}}`,
+			expected: `"a \"quoted\" line\n"`,
+		},
+		{
+			name:          "MissingVar",
+			cfg:           config.Config{Source: "Maskfile.md"},
+			code:          `{{.Vars.missing}}`,
+			expectedError: `template: Maskfile.md:1:7: executing "Maskfile.md" at <.Vars.missing>: map has no entry for key "missing"`,
+		},
+		{
+			name:          "ParseError",
+			code:          "{{.Config",
+			expectedError: "template: snippet:1: unclosed action",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := renderTemplate(&tt.cfg, tt.code)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+}
+
+func TestGenerateGoCodeTemplate(t *testing.T) {
+	cfg := &config.Config{Package: "main", Debug: true, Template: true, Vars: []string{"name=Gopher"}}
+	code, err := NewReader(strings.NewReader(`fmt.Println("Hello {{.Vars.name}}")`)).GenerateGoCode(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, code, `fmt.Println("Hello Gopher")`)
+
+	cfg.Template = false
+	code, err = NewReader(strings.NewReader(`fmt.Println("Hello {{.Vars.name}}")`)).GenerateGoCode(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, code, `fmt.Println("Hello {{.Vars.name}}")`, "templates are opt-in")
+}
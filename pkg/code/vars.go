@@ -0,0 +1,159 @@
+package code
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// declareVars renders the variables of the config as a var block. Values
+// are checked against their type before anything is compiled.
+func declareVars(cfg *config.Config) (string, error) {
+	vars, err := variables(cfg, os.Environ())
+	if err != nil || len(vars) == 0 {
+		return "", err
+	}
+
+	var out strings.Builder
+	out.WriteString("\nvar (\n")
+	for _, v := range vars {
+		typ, value, err := goValue(v)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "\t%s %s = %s\n", v.Name, typ, value)
+	}
+	out.WriteString(")\n")
+	return out.String(), nil
+}
+
+// variables returns the variables of the config, the last declaration of a
+// name wins, followed by those bound to the environment.
+func variables(cfg *config.Config, environ []string) ([]config.Var, error) {
+	var vars []config.Var
+	for _, s := range cfg.Vars {
+		v, err := config.ParseVar(s)
+		if err != nil {
+			return nil, err
+		}
+		vars = slices.DeleteFunc(vars, func(d config.Var) bool { return d.Name == v.Name })
+		vars = append(vars, v)
+	}
+
+	if cfg.VarPrefix != "" {
+		env := map[string]string{}
+		for _, kv := range environ {
+			key, value, _ := strings.Cut(kv, "=")
+			rest, ok := strings.CutPrefix(key, cfg.VarPrefix)
+			if name := camelCase(rest); ok && token.IsIdentifier(name) {
+				env[name] = value
+			}
+		}
+		for i, v := range vars {
+			if value, ok := env[v.Name]; ok && !v.HasValue {
+				vars[i].Value, vars[i].HasValue = value, true
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			if !slices.ContainsFunc(vars, func(v config.Var) bool { return v.Name == name }) {
+				vars = append(vars, config.Var{Name: name, Type: "string", Value: env[name], HasValue: true})
+			}
+		}
+	}
+
+	for _, v := range vars {
+		if !v.HasValue {
+			return nil, fmt.Errorf("variable %s has no value", v.Name)
+		}
+		if err := v.Check(); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+// camelCase turns an environment variable name like USER_NAME into
+// userName.
+func camelCase(s string) string {
+	var out strings.Builder
+	for i, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == '_' }) {
+		if i > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		out.WriteString(word)
+	}
+	return out.String()
+}
+
+// typedValue parses the value of the variable as its type.
+func typedValue(v config.Var) (any, error) {
+	switch v.Type {
+	case "int":
+		return strconv.Atoi(v.Value)
+	case "bool":
+		return strconv.ParseBool(v.Value)
+	case "duration":
+		return time.ParseDuration(v.Value)
+	case "json":
+		var value any
+		err := json.Unmarshal([]byte(v.Value), &value)
+		return value, err
+	default:
+		return v.Value, nil
+	}
+}
+
+// goValue returns the Go type and literal of the checked variable.
+func goValue(v config.Var) (string, string, error) {
+	value, err := typedValue(v)
+	if err != nil {
+		return "", "", err
+	}
+	if v.Type == "json" {
+		return "any", jsonLiteral(value), nil
+	}
+	switch value := value.(type) {
+	case int:
+		return "int", strconv.Itoa(value), nil
+	case bool:
+		return "bool", strconv.FormatBool(value), nil
+	case time.Duration:
+		return "time.Duration", fmt.Sprintf("%d // %s", value, value), nil
+	default:
+		return "string", strconv.Quote(v.Value), nil
+	}
+}
+
+// jsonLiteral renders a decoded JSON value as Go literal.
+func jsonLiteral(value any) string {
+	switch value := value.(type) {
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return "float64(" + strconv.FormatFloat(value, 'g', -1, 64) + ")"
+	case string:
+		return strconv.Quote(value)
+	case []any:
+		elems := make([]string, 0, len(value))
+		for _, e := range value {
+			elems = append(elems, jsonLiteral(e))
+		}
+		return "[]any{" + strings.Join(elems, ", ") + "}"
+	case map[string]any:
+		elems := make([]string, 0, len(value))
+		for _, k := range slices.Sorted(maps.Keys(value)) {
+			elems = append(elems, strconv.Quote(k)+": "+jsonLiteral(value[k]))
+		}
+		return "map[string]any{" + strings.Join(elems, ", ") + "}"
+	default:
+		return "nil"
+	}
+}
@@ -0,0 +1,113 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariables(t *testing.T) {
+	environ := []string{"MASK_USER_NAME=Ann", "MASK_PORT=8080", "MASK_1X=skipped", "HOME=/root"}
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		expected      []config.Var
+		expectedError string
+	}{
+		{
+			name: "LastDeclarationWins",
+			cfg:  config.Config{Vars: []string{"a=1", "b:int=2", "a:bool=true"}},
+			expected: []config.Var{
+				{Name: "b", Type: "int", Value: "2", HasValue: true},
+				{Name: "a", Type: "bool", Value: "true", HasValue: true},
+			},
+		},
+		{
+			name: "Environment",
+			cfg:  config.Config{Vars: []string{"port:int", "userName=Bob"}, VarPrefix: "MASK_"},
+			expected: []config.Var{
+				{Name: "port", Type: "int", Value: "8080", HasValue: true},
+				{Name: "userName", Type: "string", Value: "Bob", HasValue: true},
+			},
+		},
+		{
+			name: "EnvironmentOnly",
+			cfg:  config.Config{VarPrefix: "MASK_"},
+			expected: []config.Var{
+				{Name: "port", Type: "string", Value: "8080", HasValue: true},
+				{Name: "userName", Type: "string", Value: "Ann", HasValue: true},
+			},
+		},
+		{
+			name:          "NoValue",
+			cfg:           config.Config{Vars: []string{"missing:int"}, VarPrefix: "MASK_"},
+			expectedError: "variable missing has no value",
+		},
+		{
+			name:          "InvalidEnvironmentValue",
+			cfg:           config.Config{Vars: []string{"userName:int"}, VarPrefix: "MASK_"},
+			expectedError: `variable userName: "Ann" is not a valid int: strconv.Atoi: parsing "Ann": invalid syntax`,
+		},
+		{
+			name:          "InvalidConfigValue",
+			cfg:           config.Config{Vars: []string{"port:int=http"}},
+			expectedError: `variable port: "http" is not a valid int: strconv.Atoi: parsing "http": invalid syntax`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, err := variables(&tt.cfg, environ)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, vars)
+		})
+	}
+}
+
+func TestGoValue(t *testing.T) {
+	tests := []struct {
+		v             config.Var
+		expectedType  string
+		expectedValue string
+	}{
+		{config.Var{Type: "string", Value: "a \"b\""}, "string", `"a \"b\""`},
+		{config.Var{Type: "int", Value: "+42"}, "int", "42"},
+		{config.Var{Type: "bool", Value: "1"}, "bool", "true"},
+		{config.Var{Type: "duration", Value: "1m30s"}, "time.Duration", "90000000000 // 1m30s"},
+		{config.Var{Type: "json", Value: `{"b": [1.5, true, null], "a": "x"}`}, "any", `map[string]any{"a": "x", "b": []any{float64(1.5), true, nil}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.v.Type, func(t *testing.T) {
+			typ, value, err := goValue(tt.v)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedType, typ)
+			assert.Equal(t, tt.expectedValue, value)
+		})
+	}
+}
+
+func TestGenerateGoCodeVars(t *testing.T) {
+	cfg := &config.Config{
+		Package:  "main",
+		MainFunc: true,
+		Debug:    true,
+		Vars:     []string{"wait:duration=5s", "name=Gopher"},
+	}
+	code, err := NewReader(strings.NewReader("fmt.Println(name, wait)")).GenerateGoCode(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nimport (\n\t\"fmt\"\n\t\"time\"\n)\n\nfunc main() {\n\tfmt.Println(name, wait)\n}\n"+
+		"\nvar (\n\twait time.Duration = 5000000000 // 5s\n\tname string        = \"Gopher\"\n)\n", code)
+
+	cfg.Vars = []string{"port:int"}
+	_, err = NewReader(strings.NewReader("fmt.Println(port)")).GenerateGoCode(cfg)
+	assert.EqualError(t, err, "variable port has no value")
+}
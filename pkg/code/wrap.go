@@ -0,0 +1,49 @@
+package code
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// wrapper is the function the snippet statements are placed in.
+type wrapper struct {
+	open  string
+	close string
+}
+
+// newWrapper returns the wrapper selected by the config or nil if the
+// snippet is written as is.
+func newWrapper(cfg *config.Config) (*wrapper, error) {
+	switch cfg.Wrap {
+	case "":
+		if cfg.MainFunc {
+			return &wrapper{open: "func main() {\n", close: "}\n"}, nil
+		}
+		return nil, nil //nolint:nilnil // no wrapper means the snippet is written as is
+	case "test":
+		return &wrapper{open: "func TestSnippet(t *testing.T) {\n", close: "}\n"}, nil
+	case "benchmark":
+		return &wrapper{open: "func BenchmarkSnippet(b *testing.B) {\nfor b.Loop() {\n", close: "}\n}\n"}, nil
+	case "example":
+		return &wrapper{open: "func Example() {\n", close: exampleOutput(cfg.ExampleOutput) + "}\n"}, nil
+	default:
+		return nil, fmt.Errorf("unknown wrap mode %q (test, benchmark, example)", cfg.Wrap)
+	}
+}
+
+// exampleOutput renders the // Output: comment go test compares the output
+// of an example function against. Without an expected output the example is
+// compiled but not run.
+func exampleOutput(output string) string {
+	if output == "" {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString("// Output:\n")
+	for line := range strings.Lines(strings.TrimRight(output, "\n") + "\n") {
+		out.WriteString(strings.TrimRight("// "+line, " \n") + "\n")
+	}
+	return out.String()
+}
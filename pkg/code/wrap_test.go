@@ -0,0 +1,101 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateGoCodeWrap(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		code     string
+		expected string
+	}{
+		{
+			name: "Test",
+			cfg:  &config.Config{Package: "main", Wrap: "test", Debug: true},
+			code: `if strings.ToUpper("a") != "A" { t.Fatal("upper") }`,
+			expected: `package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	if strings.ToUpper("a") != "A" {
+		t.Fatal("upper")
+	}
+}
+`,
+		},
+		{
+			name: "Benchmark",
+			cfg:  &config.Config{Package: "main", Wrap: "benchmark", Debug: true},
+			code: `_ = strconv.Itoa(42)`,
+			expected: `package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func BenchmarkSnippet(b *testing.B) {
+	for b.Loop() {
+		_ = strconv.Itoa(42)
+	}
+}
+`,
+		},
+		{
+			name: "Example",
+			cfg:  &config.Config{Package: "main", Wrap: "example", ExampleOutput: "Hello\n\nWorld\n", Debug: true},
+			code: `fmt.Println("Hello\n\nWorld")`,
+			expected: `package main
+
+import "fmt"
+
+func Example() {
+	fmt.Println("Hello\n\nWorld")
+	// Output:
+	// Hello
+	//
+	// World
+}
+`,
+		},
+		{
+			name: "ExampleWithoutOutput",
+			cfg:  &config.Config{Package: "main", Wrap: "example", MainFunc: true, Debug: true},
+			code: `fmt.Println("Hello")`,
+			expected: `package main
+
+import "fmt"
+
+func Example() {
+	fmt.Println("Hello")
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(tt.code))
+			output, err := reader.GenerateGoCode(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, output)
+		})
+	}
+}
+
+func TestGenerateGoCodeUnknownWrap(t *testing.T) {
+	reader := NewReader(strings.NewReader(`fmt.Println("Hello")`))
+	_, err := reader.GenerateGoCode(&config.Config{Wrap: "fuzz"})
+	assert.ErrorContains(t, err, `unknown wrap mode "fuzz"`)
+}
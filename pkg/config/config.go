@@ -3,17 +3,30 @@ package config
 import (
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fr12k/go-file"
 
 	"gopkg.in/yaml.v3"
 )
 
+// TxtarCode is the value of Txtar that marks the code as an archive.
+const TxtarCode = "true"
+
 type (
 	stringArray []string
 
+	// envList holds KEY=VALUE pairs, unlike the values of a stringArray
+	// they aren't split at commas.
+	envList []string
+
 	Command string
 
 	Loader struct {
@@ -21,6 +34,7 @@ type (
 	}
 
 	Config struct {
+		// Args are go flags like GoFlags, which it is kept for.
 		Args      string      `yaml:"args"`
 		Command   Command     `yaml:"command"`
 		FileName  string      `yaml:"filename"`
@@ -30,9 +44,88 @@ type (
 		MainFunc  bool        `yaml:"mainfunc"`
 		Package   string      `yaml:"package"`
 		Output    string      `yaml:"output"`
+		// Wrap places the snippet in a test, benchmark or example function
+		// instead of main.
+		Wrap          string `yaml:"wrap"`
+		ExampleOutput string `yaml:"example_output"`
+		// Timeout kills the go command and the program it runs once it is
+		// exceeded. Zero means no timeout.
+		Timeout time.Duration `yaml:"timeout"`
+		// Stdin is a file passed to the program as its stdin.
+		Stdin string `yaml:"stdin"`
+		// Cache reuses the binary of a previous run command if the generated
+		// source, go flags and toolchain are the same. CacheDir defaults to
+		// go-mask in the user cache directory.
+		Cache    bool   `yaml:"cache"`
+		CacheDir string `yaml:"cache_dir"`
+		// Isolate runs the snippet in a temporary directory with its own
+		// go.mod instead of Directory. Keep leaves the directory behind.
+		Isolate   bool        `yaml:"isolate"`
+		Keep      bool        `yaml:"keep"`
+		Module    string      `yaml:"module"`
+		GoVersion string      `yaml:"go_version"`
+		Require   stringArray `yaml:"require"`
+		Replace   stringArray `yaml:"replace"`
+		// Markdown runs a go code block of the file instead of Code. Heading
+		// and Block select the block if there is more than one.
+		Markdown string `yaml:"markdown"`
+		Heading  string `yaml:"heading"`
+		Block    int    `yaml:"block"`
+		// Env are KEY=VALUE pairs added to the environment of the program.
+		Env envList `yaml:"env"`
+		// Template renders the snippet with text/template before the code
+		// is generated.
+		Template bool `yaml:"template"`
+		// Vars are declared as package variables of the snippet. VarPrefix
+		// declares a string variable for every environment variable with the
+		// prefix, e.g. userName for MASK_USER_NAME, unless a var without
+		// value declares another type for it.
+		Vars      varList `yaml:"vars"`
+		VarPrefix string  `yaml:"var_prefix"`
+		// GoFlags are passed to the go command, split like shell words.
+		// ProgramArgs are passed to the program run by the run command or to
+		// the test binary after -args, the build command ignores them.
+		GoFlags     string   `yaml:"goflags"`
+		ProgramArgs []string `yaml:"program_args"`
+		// Txtar reads the code from a txtar archive file, TxtarCode treats the
+		// code itself as an archive. Otherwise only code starting with a
+		// "-- name --" line is one, later lines like it might as well be part
+		// of a string.
+		Txtar string `yaml:"txtar"`
+		// Files are source files or globs of them added to the snippet. Files
+		// with a package clause are kept as separate files of the package,
+		// the others are appended to the code.
+		Files stringArray `yaml:"files"`
+		// Expectations the output and exit code of the program are checked
+		// against, nil if not expected. The exit code defaults to zero if
+		// any other expectation is set. Update rewrites them with the actual
+		// output instead.
+		ExpectStdout      *string `yaml:"expect_stdout"`
+		ExpectStderr      *string `yaml:"expect_stderr"`
+		ExpectExitCode    *int    `yaml:"expect_exit_code"`
+		ExpectStdoutRegex string  `yaml:"expect_stdout_regex"`
+		ExpectStderrRegex string  `yaml:"expect_stderr_regex"`
+		Update            bool    `yaml:"update"`
+		// Format of the result go-mask prints: "text", the output of the
+		// program as is, or "json", a single document describing the run.
+		Format string `yaml:"format"`
+		// Diagnostics prints the compiler errors once more as "text", "json"
+		// or "github" annotations, mapped to the source of the snippet.
+		Diagnostics string `yaml:"diagnostics"`
+		// Write makes the fmt and fix commands rewrite the snippet in its
+		// Markdown file, script or archive instead of printing it.
+		Write bool `yaml:"write"`
 
 		// Internal fields
 		Code string
+		// Source and Line name the origin of the snippet. They end up in the
+		// //line directive of the generated file so compiler errors and stack
+		// traces point into the snippet instead of the generated file.
+		Source string
+		Line   int
+		// Script is the file given after the flags, which is run as a script
+		// with the arguments following it.
+		Script string
 	}
 )
 
@@ -40,8 +133,26 @@ func (s *stringArray) String() string {
 	return strings.Join(*s, ",")
 }
 
+// Set appends the comma separated values that aren't in the array yet, so
+// flags can be applied more than once.
 func (s *stringArray) Set(value string) error {
-	*s = append(*s, strings.Split(value, ",")...)
+	for _, v := range strings.Split(value, ",") {
+		if !slices.Contains(*s, v) {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
+func (e *envList) String() string {
+	return strings.Join(*e, " ")
+}
+
+func (e *envList) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%q is not KEY=VALUE", value)
+	}
+	*e = append(*e, value)
 	return nil
 }
 
@@ -53,6 +164,10 @@ func (c *Config) SaveAs() string {
 	if c.FileName != "" {
 		return c.FileName
 	}
+	if c.Wrap != "" {
+		c.FileName = "go-mask_test.go"
+		return c.FileName
+	}
 	switch c.Command {
 	case "test":
 		c.FileName = "go-mask_test.go"
@@ -64,6 +179,27 @@ func (c *Config) SaveAs() string {
 	return c.FileName
 }
 
+// CodeFromStdin reports whether the code is read from stdin, which is then
+// no longer available to the program.
+func (c *Config) CodeFromStdin() bool {
+	return c.Code == ""
+}
+
+// LineDirective returns the //line comment that maps the following line of
+// the generated file to the given 1-based line of the snippet. Relative
+// sources are made absolute, the compiler would resolve them against its
+// work directory.
+func (c *Config) LineDirective(line int) string {
+	source := c.Source
+	if source == "" {
+		source = "snippet"
+	}
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return fmt.Sprintf("//line %s:%d:1\n", source, max(c.Line, 1)+line-1)
+}
+
 func NewLoaderBuffer(content string) *Loader {
 	return &Loader{file.NewReader(strings.NewReader(content))}
 }
@@ -96,17 +232,230 @@ func (c *Loader) LoadConfig() (*Config, error) {
 	return &config, nil
 }
 
+// UpdateFile sets the given keys of the YAML config file and keeps the rest
+// of the document, including its comments.
+func UpdateFile(path string, values map[string]any) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: config is not a mapping", path)
+	}
+
+	keys := slices.Sorted(maps.Keys(values))
+	for _, key := range keys {
+		var value yaml.Node
+		if err := value.Encode(values[key]); err != nil {
+			return err
+		}
+		root.Content = setKey(root.Content, key, &value)
+	}
+
+	var out strings.Builder
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(out.String()), info.Mode().Perm())
+}
+
+// setKey replaces the value of key in the key value pairs of a mapping or
+// appends the pair if the key is missing.
+func setKey(pairs []*yaml.Node, key string, value *yaml.Node) []*yaml.Node {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i].Value == key {
+			pairs[i+1] = value
+			return pairs
+		}
+	}
+	return append(pairs, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// ApplyFlags applies the command line flags. The arguments after -- are
+// the program arguments, otherwise the first argument after the flags is a
+// script followed by its arguments.
 func ApplyFlags(cfg *Config) error {
-	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs := newFlagSet(cfg)
 	flag.CommandLine = fs
+	args := os.Args[1:]
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rest := fs.Args()
+	switch parsed := len(args) - len(rest); {
+	case len(rest) == 0:
+	case parsed > 0 && args[parsed-1] == "--":
+		cfg.ProgramArgs = rest
+	default:
+		cfg.Script, cfg.ProgramArgs = rest[0], rest[1:]
+	}
+	return nil
+}
+
+// ArgValue returns the value of the flag on the command line without
+// applying the flags, e.g. to learn the format of the output when the others
+// are invalid. It is empty if the flag isn't given.
+func ArgValue(name string) string {
+	fs := newFlagSet(&Config{})
+	args := os.Args[1:]
+	value := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		key, v, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if hasValue {
+			if key == name {
+				value = v
+			}
+			continue
+		}
+		f := fs.Lookup(key)
+		if f == nil || isBoolFlag(f) {
+			continue
+		}
+		if i++; i < len(args) && key == name {
+			value = args[i]
+		}
+	}
+	return value
+}
+
+// isBoolFlag reports whether the flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// attributeAliases maps attribute names to the flags they stand for.
+var attributeAliases = map[string]string{
+	"imports": "i",
+	"import":  "i",
+}
+
+// ApplyAttributes applies attributes like `mainfunc` or `imports=fmt,os`,
+// the flags without their leading dash, e.g. from the info string of a
+// Markdown code block.
+func ApplyAttributes(cfg *Config, attrs []string) error {
+	fs := newFlagSet(cfg)
+	fs.SetOutput(io.Discard)
+
+	args := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		name, value, hasValue := strings.Cut(attr, "=")
+		if alias, ok := attributeAliases[name]; ok {
+			name = alias
+		}
+		if hasValue {
+			args = append(args, "-"+name+"="+value)
+		} else {
+			args = append(args, "-"+name)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("invalid attribute: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("invalid attribute: %q", fs.Arg(0))
+	}
+	return nil
+}
+
+// ApplyDirectives applies attributes like ApplyAttributes except those of
+// flags given on the command line, which take precedence. Lists like the
+// imports are extended instead.
+func ApplyDirectives(cfg *Config, attrs []string) error {
+	explicit := map[string]bool{}
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		switch f.Value.(type) {
+		case *stringArray, *envList, *varList:
+		default:
+			explicit[f.Name] = true
+		}
+	})
+
+	var apply []string
+	for _, attr := range attrs {
+		name, _, _ := strings.Cut(attr, "=")
+		if alias, ok := attributeAliases[name]; ok {
+			name = alias
+		}
+		if !explicit[name] {
+			apply = append(apply, attr)
+		}
+	}
+	return ApplyAttributes(cfg, apply)
+}
+
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	fs.Var(&cfg.Imports, "i", "Comma-separated list of strings")
-	fs.StringVar(&cfg.Args, "args", cfg.Args, "Arguments to pass to the go command")
-	fs.StringVar((*string)(&cfg.Command), "command", string(cfg.Command), "Command to run (build, run, test)")
+	fs.StringVar(&cfg.Args, "args", cfg.Args, "Arguments to pass to the go command (same as -goflags)")
+	fs.Var(&cfg.Env, "env", "Environment variable KEY=VALUE of the program")
+	fs.BoolVar(&cfg.Template, "template", cfg.Template, "Render the snippet with text/template first")
+	fs.Var(&cfg.Vars, "var", "Variable NAME[:TYPE]=VALUE of the snippet, TYPE is string, int, bool, duration or json")
+	fs.StringVar(&cfg.VarPrefix, "var-prefix", cfg.VarPrefix, "Declare a variable for every environment variable with this prefix")
+	fs.StringVar(&cfg.GoFlags, "goflags", cfg.GoFlags, "Flags to pass to the go command")
+	fs.StringVar((*string)(&cfg.Command), "command", string(cfg.Command), "Command to run (build, run, test, check, vet, fmt, fix)")
 	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable debug mode")
 	fs.StringVar(&cfg.Directory, "directory", cfg.Directory, "Directory for temporary files")
 	fs.StringVar(&cfg.Package, "package", cfg.Package, "Go package name")
 	fs.BoolVar(&cfg.MainFunc, "mainfunc", cfg.MainFunc, "Wrap code in main function")
 	fs.StringVar(&cfg.Output, "output", cfg.Output, "Output file name for build command")
+	fs.StringVar(&cfg.Wrap, "wrap", cfg.Wrap, "Wrap code in a test, benchmark or example function")
+	fs.StringVar(&cfg.ExampleOutput, "example-output", cfg.ExampleOutput, "Expected output of the example function")
+	fs.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "Kill the command after this duration (e.g. 30s)")
+	fs.StringVar(&cfg.Stdin, "stdin", cfg.Stdin, "File passed to the program as stdin")
+	fs.BoolVar(&cfg.Cache, "cache", cfg.Cache, "Reuse the binary of an identical previous run")
+	fs.StringVar(&cfg.CacheDir, "cachedir", cfg.CacheDir, "Directory of the build cache")
+	fs.BoolVar(&cfg.Isolate, "isolate", cfg.Isolate, "Run in a temporary directory with its own go.mod")
+	fs.BoolVar(&cfg.Keep, "keep", cfg.Keep, "Keep the temporary directory of -isolate")
+	fs.StringVar(&cfg.Module, "module", cfg.Module, "Module name of the -isolate go.mod")
+	fs.StringVar(&cfg.GoVersion, "goversion", cfg.GoVersion, "Go version of the -isolate go.mod")
+	fs.Var(&cfg.Require, "require", "Requirement 'module version' of the -isolate go.mod")
+	fs.Var(&cfg.Replace, "replace", "Replacement 'old => new' of the -isolate go.mod")
 	fs.StringVar(&cfg.Code, "c", cfg.Code, "Go code to run")
-	return fs.Parse(os.Args[1:])
+	fs.StringVar(&cfg.Source, "source", cfg.Source, "Name of the snippet origin used in error positions")
+	fs.IntVar(&cfg.Line, "line", cfg.Line, "Line of the snippet in its origin used in error positions")
+	fs.StringVar(&cfg.Markdown, "markdown", cfg.Markdown, "Markdown file to run a go code block of")
+	fs.StringVar(&cfg.Heading, "heading", cfg.Heading, "Heading of the -markdown code block")
+	fs.IntVar(&cfg.Block, "block", cfg.Block, "1-based index of the -markdown code block (below -heading)")
+	fs.Var(&cfg.Files, "f", "Comma-separated list of source files or globs added to the snippet")
+	fs.BoolVar(&cfg.Write, "w", cfg.Write, "Rewrite the snippet in its file with the fmt and fix commands")
+	fs.StringVar(&cfg.Diagnostics, "diagnostics", cfg.Diagnostics, "Print compiler errors as text, json or github annotations")
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "Format of the result: text or json")
+	fs.StringVar(&cfg.Txtar, "txtar", cfg.Txtar, "Txtar archive file with the files of the snippet")
+	fs.Func("expect-stdout", "Expected stdout of the program", func(s string) error {
+		cfg.ExpectStdout = &s
+		return nil
+	})
+	fs.Func("expect-stderr", "Expected stderr of the program", func(s string) error {
+		cfg.ExpectStderr = &s
+		return nil
+	})
+	fs.Func("expect-exit-code", "Expected exit code of the program", func(s string) error {
+		code, err := strconv.Atoi(s)
+		cfg.ExpectExitCode = &code
+		return err
+	})
+	fs.StringVar(&cfg.ExpectStdoutRegex, "expect-stdout-regex", cfg.ExpectStdoutRegex, "Regular expression the stdout of the program has to match")
+	fs.StringVar(&cfg.ExpectStderrRegex, "expect-stderr-regex", cfg.ExpectStderrRegex, "Regular expression the stderr of the program has to match")
+	fs.BoolVar(&cfg.Update, "update", cfg.Update, "Rewrite the expectations in the config or Markdown file with the actual output")
+	return fs
 }
@@ -2,9 +2,11 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/fr12k/go-file"
 	"github.com/stretchr/testify/assert"
@@ -41,6 +43,10 @@ func TestFileName(t *testing.T) {
 			Config{Command: "invalid"},
 			"go-mask.go",
 		},
+		{
+			Config{Command: "wrapped", Wrap: "example"},
+			"go-mask_test.go",
+		},
 	}
 	for _, tt := range test {
 		t.Run(string(tt.Config.Command), func(t *testing.T) {
@@ -223,3 +229,200 @@ output: "out.go"`,
 		})
 	}
 }
+
+func TestLineDirective(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	cfg := Config{}
+	assert.Equal(t, "//line "+wd+"/snippet:1:1\n", cfg.LineDirective(1))
+
+	cfg = Config{Source: "/work/Maskfile.md", Line: 7}
+	assert.Equal(t, "//line /work/Maskfile.md:7:1\n", cfg.LineDirective(1))
+	assert.Equal(t, "//line /work/Maskfile.md:10:1\n", cfg.LineDirective(4))
+}
+
+func TestTimeout(t *testing.T) {
+	loader := NewLoaderBuffer("timeout: 1m30s\n")
+	cfg, err := loader.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, cfg.Timeout)
+
+	os.Args = []string{"test", "-timeout=5s"}
+	err = ApplyFlags(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+}
+
+func TestApplyAttributes(t *testing.T) {
+	tests := []struct {
+		name          string
+		attrs         []string
+		expected      Config
+		expectedError string
+	}{
+		{
+			name:     "FlagsAndAliases",
+			attrs:    []string{"mainfunc", "imports=fmt,os", "package=main", "timeout=5s"},
+			expected: Config{MainFunc: true, Imports: stringArray{"fmt", "os"}, Package: "main", Timeout: 5 * time.Second},
+		},
+		{
+			name:     "Expectations",
+			attrs:    []string{"expect-stdout=", "expect-exit-code=3"},
+			expected: Config{ExpectStdout: ptr(""), ExpectExitCode: ptr(3)},
+		},
+		{
+			name:     "Files",
+			attrs:    []string{"f=helpers/*.go", "f=util.go"},
+			expected: Config{Files: stringArray{"helpers/*.go", "util.go"}},
+		},
+		{
+			name:          "InvalidExitCode",
+			attrs:         []string{"expect-exit-code=three"},
+			expectedError: "invalid attribute: invalid value \"three\" for flag -expect-exit-code: strconv.Atoi: parsing \"three\": invalid syntax",
+		},
+		{
+			name:          "UnknownAttribute",
+			attrs:         []string{"unknown"},
+			expectedError: "invalid attribute: flag provided but not defined: -unknown",
+		},
+		{
+			name:          "MissingValue",
+			attrs:         []string{"package"},
+			expectedError: "invalid attribute: flag needs an argument: -package",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{}
+			err := ApplyAttributes(&cfg, tt.attrs)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg)
+		})
+	}
+}
+
+func TestStringArrayDeduplicates(t *testing.T) {
+	sa := stringArray{"fmt"}
+	require.NoError(t, sa.Set("fmt,os"))
+	require.NoError(t, sa.Set("os"))
+	assert.Equal(t, stringArray{"fmt", "os"}, sa)
+}
+
+func TestUpdateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".go-mask.yml")
+	require.NoError(t, os.WriteFile(path, []byte("# settings\ncommand: run\nexpect_stdout: old\n"), 0o600))
+
+	err := UpdateFile(path, map[string]any{"expect_stdout": "Hello\nWorld\n", "expect_exit_code": 2})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# settings\ncommand: run\nexpect_stdout: |\n  Hello\n  World\nexpect_exit_code: 2\n", string(data))
+
+	cfg, err := NewLoader(path).LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello\nWorld\n", *cfg.ExpectStdout)
+	assert.Equal(t, 2, *cfg.ExpectExitCode)
+}
+
+func TestUpdateFileError(t *testing.T) {
+	dir := t.TempDir()
+	err := UpdateFile(filepath.Join(dir, "missing.yml"), nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(dir, "list.yml")
+	require.NoError(t, os.WriteFile(path, []byte("- run\n"), 0o600))
+	err = UpdateFile(path, map[string]any{"expect_stdout": ""})
+	assert.EqualError(t, err, path+": config is not a mapping")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestArgValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "Separate", args: []string{"go-mask", "-c", "-format", "-format", "json"}, expected: "json"},
+		{name: "Equals", args: []string{"go-mask", "-mainfunc", "--format=json"}, expected: "json"},
+		{name: "InvalidFlags", args: []string{"go-mask", "-unknown", "-format", "json", "-timeout", "soon"}, expected: "json"},
+		{name: "Script", args: []string{"go-mask", "hello.gosh", "-format", "json"}},
+		{name: "Missing", args: []string{"go-mask", "-format"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			assert.Equal(t, tt.expected, ArgValue("format"))
+		})
+	}
+}
+
+func TestApplyFlagsArguments(t *testing.T) {
+	tests := []struct {
+		name                string
+		args                []string
+		programArgs         []string
+		expectedScript      string
+		expectedProgramArgs []string
+	}{
+		{
+			name:                "DoubleDash",
+			args:                []string{"go-mask", "-c", "code", "--", "-v", "a b"},
+			expectedProgramArgs: []string{"-v", "a b"},
+		},
+		{
+			name:                "Script",
+			args:                []string{"go-mask", "-cache", "hello.gosh", "-v", "--", "Ann"},
+			expectedScript:      "hello.gosh",
+			expectedProgramArgs: []string{"-v", "--", "Ann"},
+		},
+		{
+			name:                "ConfigProgramArgs",
+			args:                []string{"go-mask", "-c", "code"},
+			programArgs:         []string{"from-config"},
+			expectedProgramArgs: []string{"from-config"},
+		},
+		{
+			name:                "FlagsOverrideConfig",
+			args:                []string{"go-mask", "--", "from-flags"},
+			programArgs:         []string{"from-config"},
+			expectedProgramArgs: []string{"from-flags"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			cfg := Config{ProgramArgs: tt.programArgs}
+			require.NoError(t, ApplyFlags(&cfg))
+			assert.Equal(t, tt.expectedScript, cfg.Script)
+			assert.Equal(t, tt.expectedProgramArgs, cfg.ProgramArgs)
+		})
+	}
+}
+
+func TestApplyDirectives(t *testing.T) {
+	os.Args = []string{"go-mask", "-command", "run", "-i", "fmt", "-env", "A=1"}
+	cfg := Config{Command: "build", Timeout: time.Second}
+	require.NoError(t, ApplyFlags(&cfg))
+
+	err := ApplyDirectives(&cfg, []string{"command=test", "timeout=5s", "import=os", "env=B=a,b"})
+	require.NoError(t, err)
+	assert.Equal(t, Command("run"), cfg.Command, "flags take precedence")
+	assert.Equal(t, 5*time.Second, cfg.Timeout, "directives override the config file")
+	assert.Equal(t, stringArray{"fmt", "os"}, cfg.Imports)
+	assert.Equal(t, envList{"A=1", "B=a,b"}, cfg.Env)
+
+	err = ApplyDirectives(&cfg, []string{"env=B"})
+	assert.EqualError(t, err, `invalid attribute: invalid value "B" for flag -env: "B" is not KEY=VALUE`)
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VarTypes are the types a variable can be declared with.
+var VarTypes = []string{"string", "int", "bool", "duration", "json"}
+
+type (
+	// Var is a variable declared for the snippet, NAME[:TYPE][=VALUE] as a
+	// flag. A variable without value takes it from the environment, see
+	// Config.VarPrefix.
+	Var struct {
+		Name     string
+		Type     string
+		Value    string
+		HasValue bool
+	}
+
+	// varList holds the variables as given, unlike the values of a
+	// stringArray they aren't split at commas.
+	varList []string
+)
+
+func (v *varList) String() string {
+	return strings.Join(*v, " ")
+}
+
+func (v *varList) Set(value string) error {
+	if _, err := ParseVar(value); err != nil {
+		return err
+	}
+	*v = append(*v, value)
+	return nil
+}
+
+// ParseVar parses a variable and checks that its value has its type.
+func ParseVar(s string) (Var, error) {
+	decl, value, hasValue := strings.Cut(s, "=")
+	name, typ, _ := strings.Cut(decl, ":")
+	v := Var{Name: strings.TrimSpace(name), Type: strings.TrimSpace(typ), Value: value, HasValue: hasValue}
+	if v.Type == "" {
+		v.Type = "string"
+	}
+
+	if !token.IsIdentifier(v.Name) {
+		return Var{}, fmt.Errorf("variable %q: invalid name", v.Name)
+	}
+	if !slices.Contains(VarTypes, v.Type) {
+		return Var{}, fmt.Errorf("variable %s: unknown type %q, use one of %s", v.Name, v.Type, strings.Join(VarTypes, ", "))
+	}
+	if hasValue {
+		if err := v.Check(); err != nil {
+			return Var{}, err
+		}
+	}
+	return v, nil
+}
+
+// Check reports an error if the value doesn't parse as the type.
+func (v Var) Check() error {
+	var err error
+	switch v.Type {
+	case "int":
+		_, err = strconv.Atoi(v.Value)
+	case "bool":
+		_, err = strconv.ParseBool(v.Value)
+	case "duration":
+		_, err = time.ParseDuration(v.Value)
+	case "json":
+		var value any
+		err = json.Unmarshal([]byte(v.Value), &value)
+	}
+	if err != nil {
+		return fmt.Errorf("variable %s: %q is not a valid %s: %w", v.Name, v.Value, v.Type, err)
+	}
+	return nil
+}
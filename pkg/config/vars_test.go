@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVar(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expected      Var
+		expectedError string
+	}{
+		{
+			name:     "DefaultsToString",
+			value:    "name=a=b, c",
+			expected: Var{Name: "name", Type: "string", Value: "a=b, c", HasValue: true},
+		},
+		{
+			name:     "Typed",
+			value:    "port:int=8080",
+			expected: Var{Name: "port", Type: "int", Value: "8080", HasValue: true},
+		},
+		{
+			name:     "WithoutValue",
+			value:    "wait:duration",
+			expected: Var{Name: "wait", Type: "duration"},
+		},
+		{
+			name:          "InvalidName",
+			value:         "func=1",
+			expectedError: `variable "func": invalid name`,
+		},
+		{
+			name:          "UnknownType",
+			value:         "port:uint=1",
+			expectedError: `variable port: unknown type "uint", use one of string, int, bool, duration, json`,
+		},
+		{
+			name:          "InvalidInt",
+			value:         "port:int=http",
+			expectedError: `variable port: "http" is not a valid int: strconv.Atoi: parsing "http": invalid syntax`,
+		},
+		{
+			name:          "InvalidBool",
+			value:         "verbose:bool=yes",
+			expectedError: `variable verbose: "yes" is not a valid bool: strconv.ParseBool: parsing "yes": invalid syntax`,
+		},
+		{
+			name:          "InvalidDuration",
+			value:         "wait:duration=5",
+			expectedError: `variable wait: "5" is not a valid duration: time: missing unit in duration "5"`,
+		},
+		{
+			name:          "InvalidJSON",
+			value:         "cfg:json={",
+			expectedError: `variable cfg: "{" is not a valid json: unexpected end of JSON input`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ParseVar(tt.value)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
+
+func TestVarFlag(t *testing.T) {
+	cfg := Config{}
+	require.NoError(t, ApplyAttributes(&cfg, []string{"var=a=1,2", "var=b:int=2"}))
+	assert.Equal(t, varList{"a=1,2", "b:int=2"}, cfg.Vars)
+
+	err := ApplyAttributes(&cfg, []string{"var=b:int=two"})
+	assert.ErrorContains(t, err, `variable b: "two" is not a valid int`)
+}
@@ -0,0 +1,113 @@
+// Package expect checks the output and exit code of a program against the
+// expectations of the config.
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ErrMismatch is returned if the program didn't meet the expectations.
+var ErrMismatch = errors.New("output doesn't match the expectations")
+
+type (
+	// Outcome is what the program printed and how it exited.
+	Outcome struct {
+		Stdout   string
+		Stderr   string
+		ExitCode int
+	}
+
+	// Mismatch is an expectation the outcome didn't meet.
+	Mismatch struct {
+		// Name is stdout, stderr or exit code.
+		Name string
+		// Report explains the mismatch, a unified diff for exact output.
+		Report string
+	}
+)
+
+// Enabled reports whether the config expects anything of the program.
+func Enabled(cfg *config.Config) bool {
+	return cfg.ExpectStdout != nil || cfg.ExpectStderr != nil || cfg.ExpectExitCode != nil ||
+		cfg.ExpectStdoutRegex != "" || cfg.ExpectStderrRegex != ""
+}
+
+// Check returns the expectations of the config the outcome doesn't meet.
+// Trailing newlines of the output are ignored and the exit code has to be
+// zero unless another one is expected.
+func Check(cfg *config.Config, out Outcome) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	for _, stream := range []struct {
+		name  string
+		want  *string
+		regex string
+		got   string
+	}{
+		{"stdout", cfg.ExpectStdout, cfg.ExpectStdoutRegex, out.Stdout},
+		{"stderr", cfg.ExpectStderr, cfg.ExpectStderrRegex, out.Stderr},
+	} {
+		if stream.want != nil {
+			want, got := normalize(*stream.want), normalize(stream.got)
+			if want != got {
+				mismatches = append(mismatches, Mismatch{Name: stream.name, Report: diff(stream.name, want, got)})
+				continue
+			}
+		}
+		if stream.regex != "" {
+			re, err := regexp.Compile(stream.regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s regex: %w", stream.name, err)
+			}
+			if !re.MatchString(stream.got) {
+				mismatches = append(mismatches, Mismatch{
+					Name:   stream.name,
+					Report: fmt.Sprintf("%s doesn't match %q:\n%s", stream.name, stream.regex, normalize(stream.got)),
+				})
+			}
+		}
+	}
+
+	want := 0
+	if cfg.ExpectExitCode != nil {
+		want = *cfg.ExpectExitCode
+	}
+	if out.ExitCode != want {
+		mismatches = append(mismatches, Mismatch{
+			Name:   "exit code",
+			Report: fmt.Sprintf("exit code %d, want %d\n", out.ExitCode, want),
+		})
+	}
+	return mismatches, nil
+}
+
+// Error returns the error reporting the names of the mismatches.
+func Error(mismatches []Mismatch) error {
+	names := make([]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		names = append(names, m.Name)
+	}
+	return fmt.Errorf("%w: %s", ErrMismatch, strings.Join(names, ", "))
+}
+
+func normalize(s string) string {
+	return strings.TrimRight(s, "\n") + "\n"
+}
+
+func diff(name, want, got string) string {
+	//nolint:errcheck // writing to a strings.Builder doesn't fail
+	d, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(strings.TrimSuffix(want, "\n")),
+		B:        difflib.SplitLines(strings.TrimSuffix(got, "\n")),
+		FromFile: "want " + name,
+		ToFile:   "got " + name,
+		Context:  3,
+	})
+	return d
+}
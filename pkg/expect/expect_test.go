@@ -0,0 +1,97 @@
+package expect
+
+import (
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, Enabled(&config.Config{}))
+	assert.True(t, Enabled(&config.Config{ExpectStdout: ptr("")}))
+	assert.True(t, Enabled(&config.Config{ExpectExitCode: ptr(0)}))
+	assert.True(t, Enabled(&config.Config{ExpectStderrRegex: "."}))
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		out           Outcome
+		expected      []Mismatch
+		expectedError string
+	}{
+		{
+			name: "Match",
+			cfg:  config.Config{ExpectStdout: ptr("Hello\n"), ExpectStderr: ptr("")},
+			out:  Outcome{Stdout: "Hello\n"},
+		},
+		{
+			name: "TrailingNewlines",
+			cfg:  config.Config{ExpectStdout: ptr("Hello")},
+			out:  Outcome{Stdout: "Hello\n\n"},
+		},
+		{
+			name: "StdoutDiff",
+			cfg:  config.Config{ExpectStdout: ptr("one\ntwo\nthree\n")},
+			out:  Outcome{Stdout: "one\n2\nthree\n"},
+			expected: []Mismatch{{
+				Name:   "stdout",
+				Report: "--- want stdout\n+++ got stdout\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+			}},
+		},
+		{
+			name: "Regex",
+			cfg:  config.Config{ExpectStdoutRegex: `^took \d+ms`, ExpectStderrRegex: "warning"},
+			out:  Outcome{Stdout: "took 12ms\n", Stderr: "error\n"},
+			expected: []Mismatch{{
+				Name:   "stderr",
+				Report: "stderr doesn't match \"warning\":\nerror\n",
+			}},
+		},
+		{
+			name:          "InvalidRegex",
+			cfg:           config.Config{ExpectStdoutRegex: "("},
+			expectedError: "invalid stdout regex: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name: "ExitCodeDefaultsToZero",
+			cfg:  config.Config{ExpectStdout: ptr("")},
+			out:  Outcome{ExitCode: 1},
+			expected: []Mismatch{{
+				Name:   "exit code",
+				Report: "exit code 1, want 0\n",
+			}},
+		},
+		{
+			name: "ExpectedExitCode",
+			cfg:  config.Config{ExpectExitCode: ptr(3)},
+			out:  Outcome{ExitCode: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches, err := Check(&tt.cfg, tt.out)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, mismatches)
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	err := Error([]Mismatch{{Name: "stdout"}, {Name: "exit code"}})
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.EqualError(t, err, "output doesn't match the expectations: stdout, exit code")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,227 @@
+package markdown
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Block is a fenced code block of a Markdown document.
+type Block struct {
+	// Heading is the text of the closest heading above the block.
+	Heading string
+	// Lang is the first word of the info string, Attrs the remaining ones.
+	Lang  string
+	Attrs []string
+	// Start and End are the 1-based lines of the opening and closing fence.
+	// Code starts on the line after Start.
+	Start int
+	End   int
+	Code  string
+	// Output is the ```output block directly following the block, only
+	// separated by blank lines.
+	Output *Block
+}
+
+// Line returns the 1-based line of the first line of code.
+func (b Block) Line() int {
+	return b.Start + 1
+}
+
+// IsGo reports whether the block holds Go code.
+func (b Block) IsGo() bool {
+	return b.Lang == "go" || b.Lang == "golang"
+}
+
+// Parse returns every fenced code block of the document. Blocks that aren't
+// closed run until the end of the document.
+func Parse(content string) []Block {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var (
+		blocks  []Block
+		heading string
+		current *Block
+		fence   string
+		code    []string
+	)
+	for i, line := range lines {
+		trimmed, indented := trimIndent(line)
+		if current != nil {
+			if indented && isClosingFence(trimmed, fence) {
+				current.End = i + 1
+				current.Code = joinLines(code)
+				blocks = append(blocks, *current)
+				current = nil
+				continue
+			}
+			code = append(code, line)
+			continue
+		}
+		if !indented {
+			continue
+		}
+		if f := openingFence(trimmed); f != "" {
+			info := strings.Fields(trimmed[len(f):])
+			current = &Block{Heading: heading, Start: i + 1}
+			if len(info) > 0 {
+				current.Lang, current.Attrs = info[0], info[1:]
+			}
+			fence, code = f, nil
+			continue
+		}
+		if h, ok := atxHeading(trimmed); ok {
+			heading = h
+		}
+	}
+	if current != nil {
+		current.End = len(lines)
+		current.Code = joinLines(code)
+		blocks = append(blocks, *current)
+	}
+
+	for i := 0; i+1 < len(blocks); i++ {
+		next := blocks[i+1]
+		between := lines[blocks[i].End : next.Start-1]
+		if next.Lang == "output" && strings.TrimSpace(strings.Join(between, "")) == "" {
+			blocks[i].Output = &next
+		}
+	}
+	return blocks
+}
+
+// Select returns the Go block below the given heading (any heading if empty)
+// with the given 1-based index among those blocks. Index 0 requires the
+// choice to be unambiguous.
+func Select(blocks []Block, heading string, index int) (Block, error) {
+	var candidates []Block
+	for _, b := range blocks {
+		if b.IsGo() && (heading == "" || strings.EqualFold(b.Heading, strings.TrimSpace(heading))) {
+			candidates = append(candidates, b)
+		}
+	}
+
+	where := "in the document"
+	if heading != "" {
+		where = fmt.Sprintf("below heading %q", heading)
+	}
+	switch {
+	case len(candidates) == 0:
+		return Block{}, fmt.Errorf("no go block %s", where)
+	case index > len(candidates) || index < 0:
+		return Block{}, fmt.Errorf("no go block %d %s, there are %d", index, where, len(candidates))
+	case index > 0:
+		return candidates[index-1], nil
+	case len(candidates) > 1:
+		return Block{}, fmt.Errorf("%d go blocks %s, select one with -block", len(candidates), where)
+	default:
+		return candidates[0], nil
+	}
+}
+
+// Rewrite returns the document with the attributes of b replaced by attrs
+// and the output block of b replaced by output, or inserted after b if it
+// has none.
+func Rewrite(content string, b Block, attrs []string, output string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	if !slices.Equal(attrs, b.Attrs) {
+		opening := lines[b.Start-1]
+		trimmed, _ := trimIndent(opening)
+		indent := opening[:len(opening)-len(trimmed)]
+		info := append([]string{openingFence(trimmed) + b.Lang}, attrs...)
+		lines[b.Start-1] = indent + strings.Join(info, " ")
+	}
+
+	fence := "```"
+	for strings.Contains(output, fence) {
+		fence += "`"
+	}
+	block := []string{fence + "output"}
+	if output != "" {
+		block = append(block, strings.Split(strings.TrimSuffix(output, "\n"), "\n")...)
+	}
+	block = append(block, fence)
+
+	if b.Output != nil {
+		lines = slices.Replace(lines, b.Output.Start-1, b.Output.End, block...)
+	} else {
+		lines = slices.Insert(lines, b.End, append([]string{""}, block...)...)
+	}
+
+	out := strings.Join(lines, "\n")
+	if strings.HasSuffix(content, "\n") {
+		out += "\n"
+	}
+	return out
+}
+
+// ReplaceCode returns the document with the code of b replaced.
+func ReplaceCode(content string, b Block, code string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	var replaced []string
+	if code != "" {
+		replaced = strings.Split(strings.TrimSuffix(code, "\n"), "\n")
+	}
+	// An unclosed block runs until the end of the document.
+	end := b.End - 1
+	opening, _ := trimIndent(lines[b.Start-1])
+	closing, _ := trimIndent(lines[end])
+	if b.End == b.Start || !isClosingFence(closing, openingFence(opening)) {
+		end = len(lines)
+	}
+	lines = slices.Replace(lines, b.Start, end, replaced...)
+
+	out := strings.Join(lines, "\n")
+	if strings.HasSuffix(content, "\n") {
+		out += "\n"
+	}
+	return out
+}
+
+// trimIndent strips the up to three spaces a fence or heading may be
+// indented by and reports false if the line is indented further.
+func trimIndent(line string) (string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	return trimmed, len(line)-len(trimmed) <= 3
+}
+
+func openingFence(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n < 3 {
+			continue
+		}
+		// backtick fences can't have backticks in their info string
+		if c == "`" && strings.Contains(line[n:], "`") {
+			return ""
+		}
+		return line[:n]
+	}
+	return ""
+}
+
+func isClosingFence(line, fence string) bool {
+	n := len(line) - len(strings.TrimLeft(line, fence[:1]))
+	return n >= len(fence) && strings.TrimSpace(line[n:]) == ""
+}
+
+func atxHeading(line string) (string, bool) {
+	n := len(line) - len(strings.TrimLeft(line, "#"))
+	if n == 0 || n > 6 || (len(line) > n && line[n] != ' ' && line[n] != '\t') {
+		return "", false
+	}
+	text := strings.TrimSpace(line[n:])
+	// an optional closing sequence of #s is not part of the heading
+	if stripped := strings.TrimRight(text, "#"); stripped == "" || strings.HasSuffix(stripped, " ") {
+		text = strings.TrimSpace(stripped)
+	}
+	return text, true
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
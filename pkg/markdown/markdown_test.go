@@ -0,0 +1,210 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const document = "# Tasks\n" +
+	"\n" +
+	"## hello ##\n" +
+	"\n" +
+	"```go mainfunc imports=fmt,os\n" +
+	"fmt.Println(\"Hello\")\n" +
+	"```\n" +
+	"\n" +
+	"### nested\n" +
+	"\n" +
+	"~~~~bash\n" +
+	"```go\n" +
+	"not a block\n" +
+	"~~~~\n" +
+	"\n" +
+	"   ```golang\n" +
+	"fmt.Println(\"one\")\n" +
+	"   ```\n" +
+	"\n" +
+	"```go\n" +
+	"# not a heading\n" +
+	"```\n" +
+	"\n" +
+	"    ```go\n" +
+	"    indented code, not a fence\n" +
+	"    ```\n" +
+	"\n" +
+	"```\n" +
+	"unclosed\n"
+
+func TestParse(t *testing.T) {
+	blocks := Parse(document)
+	require.Len(t, blocks, 5)
+
+	assert.Equal(t, Block{
+		Heading: "hello",
+		Lang:    "go",
+		Attrs:   []string{"mainfunc", "imports=fmt,os"},
+		Start:   5,
+		End:     7,
+		Code:    "fmt.Println(\"Hello\")\n",
+	}, blocks[0])
+	assert.Equal(t, 6, blocks[0].Line())
+	assert.True(t, blocks[0].IsGo())
+
+	assert.Equal(t, "bash", blocks[1].Lang)
+	assert.Equal(t, "```go\nnot a block\n", blocks[1].Code)
+	assert.False(t, blocks[1].IsGo())
+
+	assert.Equal(t, "nested", blocks[2].Heading)
+	assert.True(t, blocks[2].IsGo())
+	assert.Equal(t, 16, blocks[2].Start)
+
+	assert.Equal(t, "nested", blocks[3].Heading, "# inside a block is no heading")
+	assert.Equal(t, "# not a heading\n", blocks[3].Code)
+
+	assert.Equal(t, "", blocks[4].Lang)
+	assert.Equal(t, "unclosed\n", blocks[4].Code)
+	assert.Equal(t, 29, blocks[4].End)
+}
+
+func TestSelect(t *testing.T) {
+	blocks := Parse(document)
+
+	tests := []struct {
+		name          string
+		heading       string
+		index         int
+		expectedStart int
+		expectedError string
+	}{
+		{
+			name:          "Heading",
+			heading:       "Hello",
+			expectedStart: 5,
+		},
+		{
+			name:          "HeadingAndIndex",
+			heading:       "nested",
+			index:         2,
+			expectedStart: 20,
+		},
+		{
+			name:          "Index",
+			index:         1,
+			expectedStart: 5,
+		},
+		{
+			name:          "Ambiguous",
+			heading:       "nested",
+			expectedError: "2 go blocks below heading \"nested\", select one with -block",
+		},
+		{
+			name:          "IndexOutOfRange",
+			heading:       "nested",
+			index:         3,
+			expectedError: "no go block 3 below heading \"nested\", there are 2",
+		},
+		{
+			name:          "UnknownHeading",
+			heading:       "Tasks",
+			expectedError: "no go block below heading \"Tasks\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := Select(blocks, tt.heading, tt.index)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStart, block.Start)
+		})
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	blocks := Parse("```go\nfmt.Println(1)\n```\n\n```output\n1\n```\n\n```go\nfmt.Println(2)\n```\ntext\n```output\n2\n```\n")
+	require.Len(t, blocks, 4)
+
+	require.NotNil(t, blocks[0].Output)
+	assert.Equal(t, "1\n", blocks[0].Output.Code)
+	assert.Nil(t, blocks[2].Output, "text between the blocks")
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		attrs    []string
+		output   string
+		expected string
+	}{
+		{
+			name:     "InsertOutput",
+			content:  "## hello\n\n```go mainfunc\nfmt.Println(1)\n```\n\ntext\n",
+			attrs:    []string{"mainfunc"},
+			output:   "1\n",
+			expected: "## hello\n\n```go mainfunc\nfmt.Println(1)\n```\n\n```output\n1\n```\n\ntext\n",
+		},
+		{
+			name:     "ReplaceOutputAndAttributes",
+			content:  "  ```go mainfunc\nos.Exit(3)\n  ```\n\n```output\nold\nlines\n```\n",
+			attrs:    []string{"mainfunc", "expect-exit-code=3"},
+			output:   "",
+			expected: "  ```go mainfunc expect-exit-code=3\nos.Exit(3)\n  ```\n\n```output\n```\n",
+		},
+		{
+			name:     "LongerFence",
+			content:  "```go\nfmt.Println(\"```\")\n```",
+			output:   "```\n",
+			expected: "```go\nfmt.Println(\"```\")\n```\n\n````output\n```\n````",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := Parse(tt.content)
+			require.NotEmpty(t, blocks)
+			assert.Equal(t, tt.expected, Rewrite(tt.content, blocks[0], tt.attrs, tt.output))
+		})
+	}
+}
+
+func TestReplaceCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		code     string
+		expected string
+	}{
+		{
+			name:     "Replace",
+			content:  "## hello\n\n```go\nx:=1\n```\n\n```output\n1\n```\n",
+			code:     "x := 1\nfmt.Println(x)\n",
+			expected: "## hello\n\n```go\nx := 1\nfmt.Println(x)\n```\n\n```output\n1\n```\n",
+		},
+		{
+			name:     "Empty",
+			content:  "~~~go\nx\n~~~",
+			code:     "",
+			expected: "~~~go\n~~~",
+		},
+		{
+			name:     "Unclosed",
+			content:  "````go\nx\n```",
+			code:     "y\n",
+			expected: "````go\ny",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := Parse(tt.content)
+			require.NotEmpty(t, blocks)
+			assert.Equal(t, tt.expected, ReplaceCode(tt.content, blocks[0], tt.code))
+		})
+	}
+}
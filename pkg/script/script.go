@@ -0,0 +1,16 @@
+// Package script reads go-mask scripts, snippets that are executed like
+// shell scripts through a "#!/usr/bin/env go-mask" line.
+package script
+
+import "strings"
+
+// Parse blanks the #! line of the script, so the lines of the code keep
+// their numbers. Scripts are configured with //go-mask: directives like any
+// other snippet.
+func Parse(content string) string {
+	if strings.HasPrefix(content, "#!") {
+		_, rest, _ := strings.Cut(content, "\n")
+		content = "\n" + rest
+	}
+	return content
+}
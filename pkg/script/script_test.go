@@ -0,0 +1,32 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		expectedCode string
+	}{
+		{
+			name:         "Shebang",
+			content:      "#!/usr/bin/env go-mask\n// Greets the world.\n//go-mask:mainfunc\n\nfmt.Println()\n",
+			expectedCode: "\n// Greets the world.\n//go-mask:mainfunc\n\nfmt.Println()\n",
+		},
+		{
+			name:         "NoShebang",
+			content:      "package main\n",
+			expectedCode: "package main\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedCode, Parse(tt.content))
+		})
+	}
+}
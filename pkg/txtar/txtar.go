@@ -0,0 +1,128 @@
+// Package txtar parses txtar archives, the multi-file format of the Go
+// playground: text files separated by "-- name --" marker lines.
+package txtar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// Archive is a parsed txtar archive.
+	Archive struct {
+		// Comment is the text before the first file.
+		Comment string
+		Files   []File
+	}
+
+	File struct {
+		Name string
+		Data string
+		// Line is the 1-based line of the first line of Data in the archive.
+		Line int
+	}
+)
+
+// IsArchive reports whether data contains a file marker line.
+func IsArchive(data string) bool {
+	for line := range strings.Lines(data) {
+		if _, ok := marker(line); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StartsWithMarker reports whether the first line of data is a file marker,
+// so data is an archive without a comment.
+func StartsWithMarker(data string) bool {
+	line, _, _ := strings.Cut(data, "\n")
+	_, ok := marker(line + "\n")
+	return ok
+}
+
+// Parse splits data into the comment and the files of the archive. Every
+// file ends with a newline.
+func Parse(data string) *Archive {
+	a := &Archive{}
+	var (
+		current *File
+		text    strings.Builder
+	)
+	flush := func() {
+		if current == nil {
+			a.Comment = text.String()
+		} else {
+			current.Data = fixNewline(text.String())
+			a.Files = append(a.Files, *current)
+		}
+		text.Reset()
+	}
+
+	n := 0
+	for line := range strings.Lines(data) {
+		n++
+		if name, ok := marker(line); ok {
+			flush()
+			current = &File{Name: name, Line: n + 1}
+			continue
+		}
+		text.WriteString(line)
+	}
+	flush()
+	return a
+}
+
+// Format returns the archive in txtar format, so Parse returns it again.
+func (a *Archive) Format() string {
+	var out strings.Builder
+	out.WriteString(fixNewline(a.Comment))
+	for _, f := range a.Files {
+		fmt.Fprintf(&out, "-- %s --\n%s", f.Name, fixNewline(f.Data))
+	}
+	return out.String()
+}
+
+// Extract writes the files of the archive into dir. File names must stay
+// within dir and existing files are only kept if they have the same
+// content, never overwritten.
+func (a *Archive) Extract(dir string) error {
+	for _, f := range a.Files {
+		if !filepath.IsLocal(f.Name) {
+			return fmt.Errorf("invalid file name %q in archive", f.Name)
+		}
+		path := filepath.Join(dir, f.Name)
+		if data, err := os.ReadFile(path); err == nil {
+			if string(data) != f.Data {
+				return fmt.Errorf("%s already exists", path)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(f.Data), 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marker returns the file name of a "-- name --" line.
+func marker(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "-- ") || !strings.HasSuffix(line, " --") || len(line) < len("-- x --") {
+		return "", false
+	}
+	name := strings.TrimSpace(line[3 : len(line)-3])
+	return name, name != ""
+}
+
+func fixNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
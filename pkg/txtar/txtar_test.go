@@ -0,0 +1,78 @@
+package txtar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archive = `greet()
+-- go.mod --
+module demo
+-- main.go --
+package main
+-- testdata/name.txt --
+Gopher`
+
+func TestIsArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{name: "Archive", data: archive, expected: true},
+		{name: "Code", data: "x--\nfmt.Println(\"-- a --\")\n", expected: false},
+		{name: "EmptyName", data: "--  --\n", expected: false},
+		{name: "CRLF", data: "-- main.go --\r\npackage main\r\n", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsArchive(tt.data))
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	a := Parse(archive)
+	assert.Equal(t, "greet()\n", a.Comment)
+	assert.Equal(t, []File{
+		{Name: "go.mod", Data: "module demo\n", Line: 3},
+		{Name: "main.go", Data: "package main\n", Line: 5},
+		{Name: "testdata/name.txt", Data: "Gopher\n", Line: 7},
+	}, a.Files)
+
+	empty := Parse("-- empty.txt --\n")
+	assert.Equal(t, "", empty.Comment)
+	assert.Equal(t, []File{{Name: "empty.txt", Data: "", Line: 2}}, empty.Files)
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Parse(archive).Extract(dir))
+
+	data, err := os.ReadFile(filepath.Join(dir, "testdata", "name.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Gopher\n", string(data))
+
+	err = Parse("-- ../escape.go --\npackage main\n").Extract(dir)
+	assert.EqualError(t, err, `invalid file name "../escape.go" in archive`)
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(dir), "escape.go"))
+
+	require.NoError(t, Parse(archive).Extract(dir), "files with the same content are kept")
+	err = Parse("-- testdata/name.txt --\nAlice\n").Extract(dir)
+	assert.EqualError(t, err, filepath.Join(dir, "testdata", "name.txt")+" already exists")
+	data, err = os.ReadFile(filepath.Join(dir, "testdata", "name.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Gopher\n", string(data))
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, archive+"\n", Parse(archive).Format())
+
+	a := &Archive{Comment: "greet()", Files: []File{{Name: "a.go", Data: "package main"}}}
+	assert.Equal(t, "greet()\n-- a.go --\npackage main\n", a.Format())
+}
@@ -0,0 +1,101 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fr12k/go-mask/pkg/config"
+)
+
+// DefaultModule is the module name of the generated go.mod if the config
+// doesn't name one.
+const DefaultModule = "go-mask"
+
+var goVersion = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// Workspace is a temporary directory with its own go.mod the snippet is
+// built in, so it doesn't depend on the module go-mask is run in.
+type Workspace struct {
+	Dir  string
+	keep bool
+}
+
+// New creates the workspace and writes its go.mod. The toolchain is the
+// output of go env GOVERSION and only used if the config has no go version.
+func New(cfg *config.Config, toolchain string) (*Workspace, error) {
+	dir, err := os.MkdirTemp("", "go-mask-workspace-*")
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspace{Dir: dir, keep: cfg.Keep}
+
+	gomod, err := GoMod(cfg, toolchain)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0o600)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return ws, nil
+}
+
+// Close removes the workspace unless it should be kept for inspection.
+func (w *Workspace) Close() error {
+	if w.keep {
+		fmt.Fprintf(os.Stderr, "Kept workspace %s\n", w.Dir)
+		return nil
+	}
+	return os.RemoveAll(w.Dir)
+}
+
+// GoMod renders the go.mod of the workspace. Local replacements are made
+// absolute because they are meant relative to the directory go-mask runs in.
+func GoMod(cfg *config.Config, toolchain string) (string, error) {
+	module := cfg.Module
+	if module == "" {
+		module = DefaultModule
+	}
+	version := cfg.GoVersion
+	if version == "" {
+		version = goVersion.FindString(toolchain)
+		if version == "" {
+			return "", fmt.Errorf("can't determine go version from %q", toolchain)
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "module %s\n\ngo %s\n", module, version)
+
+	if len(cfg.Require) > 0 {
+		out.WriteString("\nrequire (\n")
+		for _, req := range cfg.Require {
+			fmt.Fprintf(&out, "\t%s\n", strings.Join(strings.Fields(req), " "))
+		}
+		out.WriteString(")\n")
+	}
+
+	if len(cfg.Replace) > 0 {
+		out.WriteString("\n")
+	}
+	for _, repl := range cfg.Replace {
+		old, replacement, ok := strings.Cut(repl, "=>")
+		if !ok {
+			return "", fmt.Errorf("invalid replace %q, expected 'old => new'", repl)
+		}
+		replacement = strings.TrimSpace(replacement)
+		if strings.HasPrefix(replacement, "./") || strings.HasPrefix(replacement, "../") {
+			abs, err := filepath.Abs(replacement)
+			if err != nil {
+				return "", err
+			}
+			replacement = abs
+		}
+		fmt.Fprintf(&out, "replace %s => %s\n", strings.TrimSpace(old), replacement)
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,106 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fr12k/go-mask/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoMod(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		cfg           *config.Config
+		toolchain     string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:      "Defaults",
+			cfg:       &config.Config{},
+			toolchain: "go1.25.5",
+			expected:  "module go-mask\n\ngo 1.25.5\n",
+		},
+		{
+			name:      "DevelToolchain",
+			cfg:       &config.Config{},
+			toolchain: "devel go1.26-abcdef",
+			expected:  "module go-mask\n\ngo 1.26\n",
+		},
+		{
+			name: "RequireAndReplace",
+			cfg: &config.Config{
+				Module:    "example.com/snippet",
+				GoVersion: "1.24",
+				Require:   []string{"github.com/fr12k/go-file  v0.0.3", "example.com/lib v0.0.0"},
+				Replace:   []string{"example.com/lib => ../lib", "github.com/a/b=>github.com/c/b v1.0.0"},
+			},
+			expected: `module example.com/snippet
+
+go 1.24
+
+require (
+	github.com/fr12k/go-file v0.0.3
+	example.com/lib v0.0.0
+)
+
+replace example.com/lib => ` + filepath.Join(filepath.Dir(wd), "lib") + `
+replace github.com/a/b => github.com/c/b v1.0.0
+`,
+		},
+		{
+			name:          "InvalidReplace",
+			cfg:           &config.Config{GoVersion: "1.24", Replace: []string{"example.com/lib ../lib"}},
+			expectedError: "invalid replace",
+		},
+		{
+			name:          "UnknownToolchain",
+			cfg:           &config.Config{},
+			toolchain:     "unknown",
+			expectedError: "can't determine go version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gomod, err := GoMod(tt.cfg, tt.toolchain)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, gomod)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Run("RemovedOnClose", func(t *testing.T) {
+		ws, err := New(&config.Config{}, "go1.25.5")
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(ws.Dir, "go.mod"))
+
+		require.NoError(t, ws.Close())
+		assert.NoDirExists(t, ws.Dir)
+	})
+
+	t.Run("Keep", func(t *testing.T) {
+		ws, err := New(&config.Config{Keep: true}, "go1.25.5")
+		require.NoError(t, err)
+		defer os.RemoveAll(ws.Dir)
+
+		require.NoError(t, ws.Close())
+		assert.DirExists(t, ws.Dir)
+	})
+
+	t.Run("InvalidGoMod", func(t *testing.T) {
+		_, err := New(&config.Config{}, "unknown")
+		assert.Error(t, err)
+	})
+}